@@ -0,0 +1,43 @@
+// Command fakeavalon serves a fake Avalon website for local development. It offers the amenities of every community in
+// config.yml and accepts one account; point a community's baseUrl at it, i.e. baseUrl: http://localhost:8081
+package main
+
+import (
+	"flag"
+	"github.com/spf13/viper"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/avalontest"
+	"github.com/stevetu717/racquetball-bot/model"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to serve the fake Avalon website on")
+	configFile := flag.String("config", "config.yml", "config file listing the communities and their amenities")
+	username := flag.String("username", "resident", "username of the account that can sign in")
+	password := flag.String("password", "password", "password of the account that can sign in")
+	leaseId := flag.String("lease", "lease", "lease ID of the account")
+	personId := flag.String("person", "person", "person ID of the account")
+	flag.Parse()
+
+	viper.SetConfigFile(*configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatal("Unable to read in config file ", err)
+	}
+
+	var config model.Config
+	if err := viper.Unmarshal(&config); err != nil {
+		log.Fatal("Unable to unmarshal config file to struct ", err)
+	}
+
+	fake := avalontest.New()
+	fake.AddAccount(avalontest.Account{Username: *username, Password: *password, LeaseId: *leaseId, PersonId: *personId})
+	for _, community := range config.Communities {
+		for _, amenity := range community.Amenities {
+			fake.AddAmenity(amenity.Key, amenity.Name)
+		}
+	}
+
+	log.Println("Serving fake Avalon website on " + *addr + " for " + *username)
+	log.Fatal(http.ListenAndServe(*addr, fake))
+}
@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/PaddleHQ/go-aws-ssm v0.8.0
 	github.com/antchfx/htmlquery v1.2.3
+	github.com/aws/aws-sdk-go v1.34.28
 	github.com/sfreiberg/gotwilio v0.0.0-20201211181435-c426a3710ab5
 	github.com/sirupsen/logrus v1.7.0
 	github.com/spf13/viper v1.7.1
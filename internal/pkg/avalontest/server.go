@@ -0,0 +1,386 @@
+// Package avalontest is a fake of the Avalon website that tests and local development can book against. It serves the
+// pages and forms the bot uses from memory: the login form, each amenity's reservation form with its hourly start
+// times, SaveAmenityReservation, the Amenities page listing upcoming reservations and their cancellation forms.
+package avalontest
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+)
+
+// Token is the __RequestVerificationToken the fake puts in every form and expects back
+const Token = "fake-request-verification-token"
+
+const sessionCookie = "fake-avalon-session"
+
+// Account is a resident who can sign in to the fake
+type Account struct {
+	Username string
+	Password string
+	LeaseId  string
+	PersonId string
+}
+
+// Reservation is a booking held by the fake. Date is formatted as "January 02, 2006" and the times as "3:04 PM" in
+// the community's timezone, as the Amenities page shows them.
+type Reservation struct {
+	Id         string
+	Username   string
+	AmenityKey string
+	Date       string
+	StartTime  string
+	EndTime    string
+	Notes      string
+	Names      string
+	People     int
+}
+
+// Server is an http.Handler faking the Avalon website, i.e. httptest.NewServer(avalontest.New())
+type Server struct {
+	mux *http.ServeMux
+
+	mu           sync.Mutex
+	accounts     map[string]Account
+	amenities    map[string]string
+	sessions     map[string]string
+	reservations []Reservation
+	nextId       int
+}
+
+func New() *Server {
+	s := &Server{
+		mux:       http.NewServeMux(),
+		accounts:  make(map[string]Account),
+		amenities: make(map[string]string),
+		sessions:  make(map[string]string),
+	}
+
+	s.mux.HandleFunc(util.AvalonLoginPath, s.handleLogin)
+	s.mux.HandleFunc(strings.Split(util.AvalonAmenityPath, "?")[0], s.handleAmenity)
+	s.mux.HandleFunc(util.AvalonSaveReservationPath, s.handleSaveReservation)
+	s.mux.HandleFunc(util.AvalonAmenitiesPath, s.handleAmenities)
+	s.mux.HandleFunc(util.AvalonCancelReservationPath, s.handleCancelReservation)
+
+	return s
+}
+
+// AddAccount lets the account sign in
+func (s *Server) AddAccount(account Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[account.Username] = account
+}
+
+// AddAmenity lets the amenity be booked. name is what the Amenities page lists its reservations under.
+func (s *Server) AddAmenity(key string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.amenities[key] = name
+}
+
+// Book holds a reservation as if it was made on the website, i.e. to take a slot before the bot tries it.
+// Returns the ID of the reservation.
+func (s *Server) Book(r Reservation) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book(r)
+}
+
+// Reservations returns the reservations held by the fake
+func (s *Server) Reservations() []Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Reservation(nil), s.reservations...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) book(r Reservation) string {
+	s.nextId++
+	r.Id = strconv.Itoa(s.nextId)
+	s.reservations = append(s.reservations, r)
+	return r.Id
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		render(w, loginPage, nil)
+		return
+	}
+
+	s.mu.Lock()
+	account, ok := s.accounts[r.PostFormValue("UserName")]
+	if !ok || account.Password != r.PostFormValue("password") || r.PostFormValue("__RequestVerificationToken") != Token {
+		s.mu.Unlock()
+		// Avalon shows the login form again with an error rather than failing the request
+		render(w, loginPage, "The user name or password provided is incorrect.")
+		return
+	}
+
+	s.nextId++
+	session := "session-" + strconv.Itoa(s.nextId)
+	s.sessions[session] = account.Username
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/"})
+	http.Redirect(w, r, util.AvalonAmenitiesPath, http.StatusFound)
+}
+
+func (s *Server) handleAmenity(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.signedIn(w, r)
+	if !ok {
+		return
+	}
+
+	// The page offers the start times of the day picked with reservationDate, today when there is none
+	date := time.Now()
+	if picked := r.URL.Query().Get("reservationDate"); picked != "" {
+		var err error
+		if date, err = time.Parse("1/2/2006", picked); err != nil {
+			http.Error(w, "The reservation date is invalid.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	type startTime struct {
+		Value string
+		Label string
+		Taken bool
+	}
+
+	s.mu.Lock()
+	key := r.URL.Query().Get("amenityKey")
+	name, ok := s.amenities[key]
+	var startTimes []startTime
+	for hour := 0; hour < 24; hour++ {
+		start := time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.UTC)
+		slot := Reservation{
+			AmenityKey: key,
+			Date:       start.Format(util.UpcomingDateLayout),
+			StartTime:  start.Format(util.UpcomingTimeLayout),
+			EndTime:    start.Add(time.Hour).Format(util.UpcomingTimeLayout),
+		}
+
+		taken := false
+		for _, other := range s.reservations {
+			taken = taken || overlaps(other, slot)
+		}
+
+		value := start.Format("Monday") + "-" + slot.StartTime + "-" + slot.EndTime
+		startTimes = append(startTimes, startTime{value, slot.StartTime + " - " + slot.EndTime, taken})
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	render(w, amenityPage, struct {
+		Name       string
+		Account    Account
+		StartTimes []startTime
+	}{name, account, startTimes})
+}
+
+func (s *Server) handleSaveReservation(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.signedIn(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost || r.PostFormValue("__RequestVerificationToken") != Token {
+		http.Error(w, "The anti-forgery token could not be validated.", http.StatusBadRequest)
+		return
+	}
+
+	if r.PostFormValue("LeaseId") != account.LeaseId || r.PostFormValue("PersonId") != account.PersonId {
+		http.Error(w, "The lease does not belong to the signed in resident.", http.StatusForbidden)
+		return
+	}
+
+	// SelStartTime is the weekday followed by the start and end times, i.e. "Thursday-7:00 PM-8:00 PM"
+	date, dateErr := time.Parse("1/2/2006", r.PostFormValue("ReservationDate"))
+	times := strings.Split(r.PostFormValue("SelStartTime"), "-")
+	if dateErr != nil || len(times) != 3 {
+		http.Error(w, "The reservation date or time is invalid.", http.StatusBadRequest)
+		return
+	}
+
+	people, _ := strconv.Atoi(r.PostFormValue("NumberOfPeople"))
+	reservation := Reservation{
+		Username:   account.Username,
+		AmenityKey: r.PostFormValue("AmenityKey"),
+		Date:       date.Format(util.UpcomingDateLayout),
+		StartTime:  times[1],
+		EndTime:    times[2],
+		Notes:      r.PostFormValue("Notes"),
+		Names:      r.PostFormValue("ReservationNames"),
+		People:     people,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.amenities[reservation.AmenityKey]; !ok {
+		http.Error(w, "The amenity does not exist.", http.StatusBadRequest)
+		return
+	}
+
+	for _, other := range s.reservations {
+		if overlaps(other, reservation) {
+			// The slot is not saved and so does not show on the Amenities page
+			render(w, messagePage, "This time is no longer available.")
+			return
+		}
+	}
+
+	s.book(reservation)
+	render(w, messagePage, "Your reservation has been submitted.")
+}
+
+func (s *Server) handleAmenities(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.signedIn(w, r)
+	if !ok {
+		return
+	}
+
+	type upcoming struct {
+		Reservation
+		AmenityName string
+		Token       string
+	}
+
+	s.mu.Lock()
+	var reservations []upcoming
+	for _, reservation := range s.reservations {
+		if reservation.Username == account.Username {
+			reservations = append(reservations, upcoming{reservation, s.amenities[reservation.AmenityKey], Token})
+		}
+	}
+	s.mu.Unlock()
+
+	render(w, amenitiesPage, reservations)
+}
+
+func (s *Server) handleCancelReservation(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.signedIn(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost || r.PostFormValue("__RequestVerificationToken") != Token {
+		http.Error(w, "The anti-forgery token could not be validated.", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, reservation := range s.reservations {
+		if reservation.Id == r.PostFormValue("Id") && reservation.Username == account.Username {
+			s.reservations = append(s.reservations[:i], s.reservations[i+1:]...)
+			http.Redirect(w, r, util.AvalonAmenitiesPath, http.StatusFound)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// Returns the account signed in with the request's session, redirecting to the login form if there is none
+func (s *Server) signedIn(w http.ResponseWriter, r *http.Request) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if username, ok := s.sessions[cookie.Value]; ok {
+			return s.accounts[username], true
+		}
+	}
+
+	http.Redirect(w, r, util.AvalonLoginPath, http.StatusFound)
+	return Account{}, false
+}
+
+// Returns true if two reservations are for the same amenity at overlapping times
+func overlaps(a Reservation, b Reservation) bool {
+	if a.AmenityKey != b.AmenityKey || a.Date != b.Date {
+		return false
+	}
+
+	aStart, aEnd := minutes(a.StartTime), minutes(a.EndTime)
+	bStart, bEnd := minutes(b.StartTime), minutes(b.EndTime)
+	return aStart < bEnd && bStart < aEnd
+}
+
+// Returns the minutes since midnight of a time formatted as "3:04 PM", a reservation ending at midnight ending at 24:00
+func minutes(clock string) int {
+	t, err := time.Parse(util.UpcomingTimeLayout, clock)
+	if err != nil {
+		return 0
+	}
+
+	m := t.Hour()*60 + t.Minute()
+	if m == 0 {
+		return 24 * 60
+	}
+	return m
+}
+
+func render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<html><body>
+{{if .}}<div class="validation-summary-errors">{{.}}</div>{{end}}
+<form action="` + util.AvalonLoginPath + `" method="post">
+<input name="__RequestVerificationToken" type="hidden" value="` + Token + `">
+<input name="UserName" type="text">
+<input name="password" type="password">
+</form>
+</body></html>`))
+
+var amenityPage = template.Must(template.New("amenity").Parse(`<html><body>
+<h1>{{.Name}}</h1>
+<form action="` + util.AvalonSaveReservationPath + `" method="post">
+<input name="__RequestVerificationToken" type="hidden" value="` + Token + `">
+<input name="LeaseId" type="hidden" value="{{.Account.LeaseId}}">
+<input name="PersonId" type="hidden" value="{{.Account.PersonId}}">
+<select name="SelStartTime">
+<option value="">Select a time</option>
+{{range .StartTimes}}<option value="{{.Value}}"{{if .Taken}} disabled{{end}}>{{.Label}}</option>
+{{end}}</select>
+</form>
+</body></html>`))
+
+// The bot reads the amenity name and details of each upcoming reservation by their position in the markup, so the
+// nesting and whitespace here follow the Avalon website
+var amenitiesPage = template.Must(template.New("amenities").Parse(`<html><body>
+<div id="upcomingReservation">
+<div>
+{{range .}}<div>
+<div>
+<div><a href="#"><strong>{{.AmenityName}}</strong></a></div>
+<p>{{.Date}} {{.StartTime}} - {{.EndTime}}</p>
+<form action="` + util.AvalonCancelReservationPath + `" method="post">
+<input name="__RequestVerificationToken" type="hidden" value="{{.Token}}">
+<input name="Id" type="hidden" value="{{.Id}}">
+</form>
+</div>
+</div>
+{{end}}</div>
+</div>
+</body></html>`))
+
+var messagePage = template.Must(template.New("message").Parse(`<html><body><p>{{.}}</p></body></html>`))
@@ -0,0 +1,226 @@
+package messages
+
+// Keys of the messages sent to users, used to name their templates in every language
+const (
+	Help                   = "help"
+	ReservationSaved       = "reservation_saved"
+	ReservationError       = "reservation_error"
+	InvalidDateTime        = "invalid_date_time"
+	OutsideOpeningHours    = "outside_opening_hours"
+	AmenityClosed          = "amenity_closed"
+	InvalidDuration        = "invalid_duration"
+	InvalidSlot            = "invalid_slot"
+	NotesTooLong           = "notes_too_long"
+	ReservationNote        = "reservation_note"
+	InvalidPartySize       = "invalid_party_size"
+	NameSaved              = "name_saved"
+	InvalidName            = "invalid_name"
+	LanguageSet            = "language_set"
+	InvalidLanguage        = "invalid_language"
+	NotRegistered          = "not_registered"
+	AccessRequested        = "access_requested"
+	AccessPending          = "access_pending"
+	AccessDenied           = "access_denied"
+	AccessApproved         = "access_approved"
+	AccessRequestAdmin     = "access_request_admin"
+	UserApproved           = "user_approved"
+	UserDenied             = "user_denied"
+	UserNotFound           = "user_not_found"
+	InvalidApproval        = "invalid_approval"
+	AccountLinked          = "account_linked"
+	AccountUnlinked        = "account_unlinked"
+	LinkFailed             = "link_failed"
+	InvalidLink            = "invalid_link"
+	InvalidCommand         = "invalid_command"
+	InvalidActivity        = "invalid_activity"
+	SuccessfulReservation  = "successful_reservation"
+	SuccessfulAlternative  = "successful_alternative"
+	FailedReservation      = "failed_reservation"
+	FailedLoginRejected    = "failed_login_rejected"
+	FailedSlotTaken        = "failed_slot_taken"
+	FailedOutsideWindow    = "failed_outside_window"
+	FailedSiteChanged      = "failed_site_changed"
+	FailedNetwork          = "failed_network"
+	AvailableTimes         = "available_times"
+	NoAvailableTimes       = "no_available_times"
+	AvailabilityFailed     = "availability_failed"
+	InvalidAvail           = "invalid_avail"
+	CancelledReservation   = "cancelled_reservation"
+	CancelNotFound         = "cancel_not_found"
+	CancelInProgress       = "cancel_in_progress"
+	CancelFailed           = "cancel_failed"
+	InvalidCancel          = "invalid_cancel"
+	ListReservations       = "list_reservations"
+	ListPending            = "list_pending"
+	ListBooked             = "list_booked"
+	ListFailed             = "list_failed"
+	ListRemoved            = "list_removed"
+	ListElsewhere          = "list_elsewhere"
+	ReservationRemoved     = "reservation_removed"
+	NoReservations         = "no_reservations"
+	RuleSaved              = "rule_saved"
+	InvalidRule            = "invalid_rule"
+	ListRules              = "list_rules"
+	ListRule               = "list_rule"
+	NoRules                = "no_rules"
+	RuleStopped            = "rule_stopped"
+	RuleNotFound           = "rule_not_found"
+	MovedReservation       = "moved_reservation"
+	MovingReservation      = "moving_reservation"
+	MovedBookedReservation = "moved_booked_reservation"
+	MoveFailed             = "move_failed"
+	ReleaseFailed          = "release_failed"
+	MoveNotFound           = "move_not_found"
+	MoveInProgress         = "move_in_progress"
+	InvalidMove            = "invalid_move"
+	CancelledMove          = "cancelled_move"
+	ConfirmReservation     = "confirm_reservation"
+	ConfirmYesNo           = "confirm_yes_no"
+	RequestDiscarded       = "request_discarded"
+	NothingToConfirm       = "nothing_to_confirm"
+	DailyLimit             = "daily_limit"
+	SlotTaken              = "slot_taken"
+	SlotLost               = "slot_lost"
+	OpenTimes              = "open_times"
+	NoOpenTimes            = "no_open_times"
+	AdminHelp              = "admin_help"
+	AdminPending           = "admin_pending"
+	AdminPendingEntry      = "admin_pending_entry"
+	AdminNoPending         = "admin_no_pending"
+	AdminCancelled         = "admin_cancelled"
+	AdminInvalidCancel     = "admin_invalid_cancel"
+	SchedulerPaused        = "scheduler_paused"
+	SchedulerAlreadyPaused = "scheduler_already_paused"
+	SchedulerResumed       = "scheduler_resumed"
+	SchedulerNotPaused     = "scheduler_not_paused"
+	LoginSucceeded         = "login_succeeded"
+	LoginFailed            = "login_failed"
+	LoginRejected          = "login_rejected"
+	LoginSiteChanged       = "login_site_changed"
+	LoginNetwork           = "login_network"
+	LoginUnexpected        = "login_unexpected"
+	AdminCommunitySet      = "admin_community_set"
+	AdminInvalidCommunity  = "admin_invalid_community"
+	OptedOut               = "opted_out"
+	OptedOutByCancel       = "opted_out_by_cancel"
+	OptedIn                = "opted_in"
+)
+
+// english is the built-in set of templates, used for every message a language does not translate
+var english = map[string]string{
+	Help: "To use this system please message in the format: <activity> <date> <time>. Examples: tennis1 2/12/21 8:00pm, racquetball tomorrow 7pm, basketball fri 18:00. " +
+		"Add a length for longer bookings, e.g. tennis1 3/4/21 6:00pm 2h. " +
+		"Add guests at the end, e.g. racquetball 3/4/21 7:00pm with Alex, Sam, or a party size with 'party of 4'. " +
+		"End with 'note: <text>' to tell building staff what the booking is for. " +
+		"Text 'link <avalon username> <avalon password>' to book under your own lease and 'unlink' to stop. " +
+		"Text 'name <your name>' to set the name bookings are made under and 'language <code>' to change the language of these messages. " +
+		"List fallback times with 'or', e.g. racquetball 3/4/21 7:00pm or 8:00pm. " +
+		"We will reply with a summary of your request; reply YES to confirm it. " +
+		"Valid activities: {{.Activities}}. Only 1 reservation per activity per day will work. " +
+		"To repeat weekly text: <activity> every <weekday> <time> [until <date>]. Text 'rules' to see them and 'stop rule <ID>' to end one. " +
+		"To move a reservation text: move <activity> <date> <time> to <date> <time>. To see your reservations text: list. To see the open times of a day text: avail <activity> <date>. To cancel a reservation, pending or booked, text: cancel <activity> <date> <time> or cancel <ID>. " +
+		"CANCEL on its own is a carrier keyword that unsubscribes you from all messages, like STOP.",
+	ReservationSaved:       "Your reservation has been saved (ID: {{.Id}}). We will attempt to secure it the day before the reservation. Thank you!",
+	ReservationError:       "Failed to save the reservation. Contact the dev with Rsvp ID: {{.Id}}",
+	InvalidDateTime:        "Please enter a date and time in the correct format. Text 'assist' for help.",
+	OutsideOpeningHours:    "{{.Activity}} is only open {{.Hours}} on {{.Date}}. Please try again with a time that starts and ends within those hours.",
+	AmenityClosed:          "{{.Activity}} is closed on {{.Date}}. Please try again with another day.",
+	InvalidDuration:        "{{.Activity}} can only be booked for {{.Lengths}}. Please try again with a valid length.",
+	InvalidSlot:            "{{.Activity}} can only be booked at {{.Length}} intervals (e.g. 7:00pm). Please try again with a valid time.",
+	NotesTooLong:           "Notes can be at most {{.Max}} characters. Please shorten your note and try again.",
+	ReservationNote:        "Note: {{.Note}}",
+	InvalidPartySize:       "{{.Activity}} can only be booked for up to {{.Max}} people. Please try again with a smaller party.",
+	NameSaved:              "Thanks {{.Name}}! Your reservations will now be made under this name.",
+	InvalidName:            "Please enter your name in the format: name <your name>. Text 'assist' for help.",
+	LanguageSet:            "Your messages will now be sent in {{.Language}}.",
+	InvalidLanguage:        "Please enter a language in the format: language <code>. Languages: {{.Languages}}.",
+	NotRegistered:          "This number is not registered. Text 'request access <your name>' to ask an admin for access.",
+	AccessRequested:        "Thanks {{.Name}}! Your request has been sent to an admin. We will text you once it has been reviewed.",
+	AccessPending:          "Your access request is still waiting for an admin to review it.",
+	AccessDenied:           "Your access request has been denied.",
+	AccessApproved:         "Your access request has been approved! Text 'assist' for help.",
+	AccessRequestAdmin:     "{{.Name}} ({{.Phone}}) has requested access. Text 'approve {{.Phone}}' or 'deny {{.Phone}}'.",
+	UserApproved:           "{{.Name}} ({{.Phone}}) has been approved.",
+	UserDenied:             "{{.Name}} ({{.Phone}}) has been denied.",
+	UserNotFound:           "We could not find a user with the number {{.Phone}}.",
+	InvalidApproval:        "Please enter the user in the format: approve <phone number> or deny <phone number>.",
+	AccountLinked:          "Your Avalon account {{.Username}} has been linked and your reservations will now be made under your own lease. You may want to delete the message containing your password.",
+	AccountUnlinked:        "Your Avalon account has been unlinked. Your reservations will be made under the community account.",
+	LinkFailed:             "We were unable to sign in to Avalon with those credentials. Please check them and try again.",
+	InvalidLink:            "Please link your account in the format: link <avalon username> <avalon password>. Text 'assist' for help.",
+	InvalidCommand:         "Please enter a valid command to the avalon activity reservation system. Text 'assist' for help.",
+	InvalidActivity:        "Please enter a valid activity you would like to schedule. Text 'assist' for help.",
+	SuccessfulReservation:  "Your reservation has been successfully made for {{.Activity}} on {{.Date}}.",
+	SuccessfulAlternative:  "Your first choice was taken, so your reservation has been made for {{.Activity}} on {{.Date}} instead.",
+	FailedReservation:      "We were unable to make your reservation for {{.Activity}} on {{.Date}}. It may have been taken or the website has changed.",
+	FailedLoginRejected:    "We were unable to make your reservation for {{.Activity}} on {{.Date}} because Avalon rejected the sign-in. If you linked your own account, text 'link <avalon username> <avalon password>' to update it.",
+	FailedSlotTaken:        "We were unable to make your reservation for {{.Activity}} on {{.Date}} because it was already taken on Avalon.",
+	FailedOutsideWindow:    "We were unable to make your reservation for {{.Activity}} on {{.Date}} because it is outside the Avalon booking window.",
+	FailedSiteChanged:      "We were unable to make your reservation for {{.Activity}} on {{.Date}} because the Avalon website has changed. Please book it on the website.",
+	FailedNetwork:          "We were unable to make your reservation for {{.Activity}} on {{.Date}} because the Avalon website could not be reached.",
+	AvailableTimes:         "{{.Activity}} is open on {{.Date}} at {{.Times}}.",
+	NoAvailableTimes:       "{{.Activity}} has no open times on {{.Date}}.",
+	AvailabilityFailed:     "We were unable to check the open times of {{.Activity}} on {{.Date}}. Please try again later.",
+	InvalidAvail:           "Please enter the activity and date in the format: avail <activity> <date>. Text 'assist' for help.",
+	CancelledReservation:   "Your reservation for {{.Activity}} on {{.Date}} has been cancelled.",
+	CancelNotFound:         "We could not find an upcoming reservation matching your request. Text 'assist' for help.",
+	CancelInProgress:       "Your reservation for {{.Activity}} on {{.Date}} is already being made and can no longer be cancelled.",
+	CancelFailed:           "We were unable to cancel your reservation for {{.Activity}} on {{.Date}} on Avalon. Please cancel it on the Avalon website.",
+	InvalidCancel:          "Please enter the reservation to cancel in the format: cancel <activity> <date> <time> or cancel <ID>. Text 'assist' for help.",
+	ListReservations:       "Your reservations:",
+	ListPending:            "{{.Activity}} on {{.Date}} - pending, we will attempt to book it at {{.Time}} (ID: {{.Id}})",
+	ListBooked:             "{{.Activity}} on {{.Date}} - booked (ID: {{.Id}})",
+	ListFailed:             "{{.Activity}} on {{.Date}} - failed",
+	ListRemoved:            "{{.Activity}} on {{.Date}} - no longer on Avalon",
+	ListElsewhere:          "{{.Activity}} on {{.Date}} - booked on the Avalon website",
+	ReservationRemoved:     "Your reservation for {{.Activity}} on {{.Date}} is no longer listed on Avalon. It may have been cancelled by the building staff.",
+	NoReservations:         "You have no pending or completed reservations. Text 'assist' for help.",
+	RuleSaved:              "Your weekly reservation for {{.Activity}} every {{.Weekday}} at {{.Time}} has been saved (ID: {{.Id}}). We will book each week as the reservation window opens.",
+	InvalidRule:            "Please enter a weekly reservation in the format: <activity> every <weekday> <time> [until <date>]. Text 'assist' for help.",
+	ListRules:              "Your weekly reservations:",
+	ListRule:               "{{.Activity}} every {{.Weekday}} at {{.Time}}{{if .Until}} until {{.Until}}{{end}} (ID: {{.Id}})",
+	NoRules:                "You have no weekly reservations. Text 'assist' for help.",
+	RuleStopped:            "Your weekly reservation for {{.Activity}} every {{.Weekday}} at {{.Time}} has been stopped.",
+	RuleNotFound:           "We could not find a weekly reservation matching your request. Text 'rules' to see them.",
+	MovedReservation:       "Your reservation for {{.Activity}} has been moved from {{.OldDate}} to {{.NewDate}}.",
+	MovingReservation:      "We will book {{.Activity}} on {{.NewDate}} and release your reservation on {{.OldDate}} once the new time is secured.",
+	MovedBookedReservation: "Your reservation for {{.Activity}} has been moved to {{.NewDate}} and your previous reservation on {{.OldDate}} has been released.",
+	MoveFailed:             "We were unable to move your reservation for {{.Activity}} to {{.NewDate}}. You still have your reservation on {{.OldDate}}.",
+	ReleaseFailed:          "Your reservation for {{.Activity}} has been made for {{.NewDate}}, but we were unable to release your previous reservation on {{.OldDate}}. Please cancel it on the Avalon website.",
+	MoveNotFound:           "We could not find a reservation matching your request. Text 'list' to see your reservations.",
+	MoveInProgress:         "Your reservation for {{.Activity}} on {{.Date}} is already being made and can no longer be moved.",
+	InvalidMove:            "Please enter the move in the format: move <activity> <date> <time> to <date> <time>. Text 'assist' for help.",
+	CancelledMove:          "The move of your reservation for {{.Activity}} has been cancelled. You still have your reservation on {{.OldDate}}.",
+	ConfirmReservation:     "{{.Summary}} — reply YES (or 1) to confirm or NO (or 2) to discard.",
+	ConfirmYesNo:           "Please reply YES (or 1) to confirm your reservation or NO (or 2) to discard it.",
+	RequestDiscarded:       "Your request has been discarded.",
+	NothingToConfirm:       "There is nothing waiting for your reply or your request has expired. Text 'assist' for help.",
+	DailyLimit:             "You already have a reservation for {{.Activity}} on {{.Date}} ({{.Status}}). Only 1 reservation per activity per day is allowed.",
+	SlotTaken:              "Another resident has already requested {{.Activity}} on {{.Date}} so your request was not saved. {{.Times}}",
+	SlotLost:               "Your reservation for {{.Activity}} on {{.Date}} was given to another resident who requested the same time. {{.Times}}",
+	OpenTimes:              "Times still open that day: {{.Times}}.",
+	NoOpenTimes:            "No other times are open that day.",
+	AdminHelp: "Admin commands: 'admin pending' to list every pending reservation, 'admin cancel <ID>' to cancel any pending or booked reservation, " +
+		"'admin pause' and 'admin resume' to hold and release the scheduler, 'admin login' to test signing in to Avalon " +
+		"and 'admin community <phone number> <community>' to move a user to another building.",
+	AdminPending:           "Pending reservations:",
+	AdminPendingEntry:      "{{.Summary}} for {{.Name}}",
+	AdminNoPending:         "There are no pending reservations.",
+	AdminCancelled:         "The reservation for {{.Activity}} on {{.Date}} made by {{.Phone}} has been cancelled and they have been notified.",
+	AdminInvalidCancel:     "Please enter the reservation to cancel in the format: admin cancel <ID>.",
+	SchedulerPaused:        "The scheduler is paused. Reservations that come due will be held until you text 'admin resume'. A restart resumes the scheduler.",
+	SchedulerAlreadyPaused: "The scheduler is already paused.",
+	SchedulerResumed:       "The scheduler has been resumed and {{.Count}} held reservation(s) are being made now.",
+	SchedulerNotPaused:     "The scheduler is not paused.",
+	LoginSucceeded:         "Signed in to Avalon as {{.Username}} ({{.Community}}) successfully.",
+	LoginFailed:            "Unable to sign in to Avalon as {{.Username}} ({{.Community}}): {{.Reason}}",
+	LoginRejected:          "Avalon rejected the username or password.",
+	LoginSiteChanged:       "the Avalon website has changed.",
+	LoginNetwork:           "the Avalon website could not be reached.",
+	LoginUnexpected:        "an unexpected error occurred, see the logs.",
+	AdminCommunitySet:      "{{.Phone}} will now book in {{.Community}}.",
+	AdminInvalidCommunity:  "Please enter the user and community in the format: admin community <phone number> <community>. Communities: {{.Communities}}.",
+	OptedOut:               "You have been unsubscribed and will receive no further messages. Reply START to resubscribe.",
+	OptedOutByCancel:       "CANCEL on its own unsubscribes you and you will receive no further messages. If you meant to cancel a reservation, reply START and then text: cancel <activity> <date> <time> or cancel <ID>.",
+	OptedIn:                "You have been resubscribed and will receive messages again. Reply HELP for help or STOP to unsubscribe.",
+}
@@ -0,0 +1,163 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// DefaultLanguage is the language of the built-in messages, used for users who have not chosen one
+const DefaultLanguage = "en"
+
+// Data holds the fields a message template can refer to, i.e. {{.Activity}}. Dates and times are already formatted
+// in the community's timezone.
+type Data struct {
+	Activity    string
+	Date        string
+	OldDate     string
+	NewDate     string
+	Time        string
+	Weekday     string
+	Until       string
+	Id          string
+	Status      string
+	Reason      string
+	Name        string
+	Phone       string
+	Username    string
+	Community   string
+	Communities string
+	Activities  string
+	Language    string
+	Languages   string
+	Summary     string
+	Times       string
+	Hours       string
+	Length      string
+	Lengths     string
+	Note        string
+	Max         int
+	Count       int
+}
+
+// Catalog holds the message templates of every language
+type Catalog struct {
+	languages map[string]map[string]*template.Template
+}
+
+// Load parses the built-in English messages and the translations and overrides of every language. dir holds a
+// <language>.yml file of templates by message key per language; templates maps a language to templates by message key
+// and takes precedence over the files. Either may be empty.
+func Load(dir string, templates map[string]map[string]string) (*Catalog, error) {
+	sources := make(map[string]map[string]string)
+	sources[DefaultLanguage] = make(map[string]string)
+	for key, text := range english {
+		sources[DefaultLanguage][key] = text
+	}
+
+	if dir != "" {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".yml" {
+				continue
+			}
+
+			language := strings.ToLower(strings.TrimSuffix(file.Name(), ".yml"))
+			texts, err := readFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			merge(sources, language, texts)
+		}
+	}
+
+	for language, texts := range templates {
+		merge(sources, strings.ToLower(language), texts)
+	}
+
+	catalog := &Catalog{languages: make(map[string]map[string]*template.Template)}
+	for language, texts := range sources {
+		catalog.languages[language] = make(map[string]*template.Template)
+		for key, text := range texts {
+			if _, ok := english[key]; !ok {
+				return nil, errors.New("unknown message " + key + " in language " + language)
+			}
+
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid message %s in language %s: %v", key, language, err)
+			}
+
+			// Referring to a field that Data does not have only fails once the template is filled
+			if err = tmpl.Execute(ioutil.Discard, Data{}); err != nil {
+				return nil, fmt.Errorf("invalid message %s in language %s: %v", key, language, err)
+			}
+			catalog.languages[language][key] = tmpl
+		}
+	}
+
+	return catalog, nil
+}
+
+// Render fills the message in the language, falling back to English when the language does not translate it
+func (c *Catalog) Render(language string, key string, data Data) string {
+	var b strings.Builder
+	if tmpl, ok := c.languages[strings.ToLower(language)][key]; ok && tmpl.Execute(&b, data) == nil {
+		return b.String()
+	}
+
+	b.Reset()
+	if tmpl, ok := c.languages[DefaultLanguage][key]; ok && tmpl.Execute(&b, data) == nil {
+		return b.String()
+	}
+
+	return key
+}
+
+// Languages returns the codes of every language with messages, in alphabetical order
+func (c *Catalog) Languages() []string {
+	var languages []string
+	for language := range c.languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// HasLanguage returns true if there are messages in the language
+func (c *Catalog) HasLanguage(language string) bool {
+	_, ok := c.languages[strings.ToLower(language)]
+	return ok
+}
+
+func readFile(path string) (map[string]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	texts := make(map[string]string)
+	for key := range v.AllSettings() {
+		texts[key] = v.GetString(key)
+	}
+	return texts, nil
+}
+
+func merge(sources map[string]map[string]string, language string, texts map[string]string) {
+	if sources[language] == nil {
+		sources[language] = make(map[string]string)
+	}
+	for key, text := range texts {
+		sources[language][strings.ToLower(key)] = text
+	}
+}
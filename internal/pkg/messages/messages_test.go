@@ -0,0 +1,78 @@
+package messages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	catalog, err := Load("", map[string]map[string]string{
+		"es": {ReservationSaved: "Su reserva ha sido guardada (ID: {{.Id}})."},
+		"EN": {NoRules: "No weekly reservations."},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		key      string
+		data     Data
+		want     string
+	}{
+		{"Built-in English", DefaultLanguage, CancelledReservation, Data{Activity: "tennis1", Date: "Mar 4, 7:00 PM"}, "Your reservation for tennis1 on Mar 4, 7:00 PM has been cancelled."},
+		{"Translated", "es", ReservationSaved, Data{Id: "abc"}, "Su reserva ha sido guardada (ID: abc)."},
+		{"Language in any case", "ES", ReservationSaved, Data{Id: "abc"}, "Su reserva ha sido guardada (ID: abc)."},
+		{"Untranslated falls back to English", "es", NameSaved, Data{Name: "Sam"}, "Thanks Sam! Your reservations will now be made under this name."},
+		{"Unknown language falls back to English", "fr", NameSaved, Data{Name: "Sam"}, "Thanks Sam! Your reservations will now be made under this name."},
+		{"English override", DefaultLanguage, NoRules, Data{}, "No weekly reservations."},
+		{"Optional field", DefaultLanguage, ListRule, Data{Activity: "rb", Weekday: "Tuesday", Time: "7:00 PM", Until: "June 1", Id: "abc"}, "rb every Tuesday at 7:00 PM until June 1 (ID: abc)"},
+		{"Optional field empty", DefaultLanguage, ListRule, Data{Activity: "rb", Weekday: "Tuesday", Time: "7:00 PM", Id: "abc"}, "rb every Tuesday at 7:00 PM (ID: abc)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := catalog.Render(tt.language, tt.key, tt.data); got != tt.want {
+				t.Errorf("Render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := catalog.Languages(), []string{"en", "es"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Languages() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]map[string]string
+	}{
+		{"Unknown message", map[string]map[string]string{"es": {"not_a_message": "hola"}}},
+		{"Unparseable template", map[string]map[string]string{"es": {NameSaved: "Gracias {{.Name"}}},
+		{"Unknown field", map[string]map[string]string{"es": {NameSaved: "Gracias {{.Nombre}}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load("", tt.templates); err == nil {
+				t.Errorf("Load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	catalog, err := Load("../../../messages", nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !catalog.HasLanguage("es") {
+		t.Fatalf("HasLanguage(es) = false, want true")
+	}
+
+	want := "Su reserva para tennis1 el Mar 4, 7:00 PM ha sido cancelada."
+	if got := catalog.Render("es", CancelledReservation, Data{Activity: "tennis1", Date: "Mar 4, 7:00 PM"}); got != want {
+		t.Errorf("Render() = %v, want %v", got, want)
+	}
+}
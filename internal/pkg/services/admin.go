@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Dispatches the operational commands that only admins may use, i.e. "admin pending"
+func (sms *SMSHandler) handleAdminSMS(body string, userPhoneNumber string) error {
+	admin, err := sms.getUser(userPhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if admin == nil || !admin.IsAdmin() {
+		util.LogInfo(sms.logger, "Rejected admin command from non-admin "+userPhoneNumber)
+		return sms.sendCommandHelp(userPhoneNumber)
+	}
+
+	command := strings.TrimSpace(strings.TrimSpace(body)[len(util.Admin):])
+	util.LogInfo(sms.logger, "Admin command from "+userPhoneNumber+": "+command)
+
+	switch {
+	case command == util.AdminPending:
+		return sms.handleAdminPendingSMS(userPhoneNumber)
+	case strings.HasPrefix(command, util.AdminCancel):
+		return sms.handleAdminCancelSMS(command, userPhoneNumber)
+	case command == util.AdminPause:
+		return sms.handleAdminPauseSMS(userPhoneNumber)
+	case command == util.AdminResume:
+		return sms.handleAdminResumeSMS(userPhoneNumber)
+	case command == util.AdminLogin:
+		return sms.handleAdminLoginSMS(userPhoneNumber)
+	case strings.HasPrefix(command, util.AdminCommunity):
+		return sms.handleAdminCommunitySMS(command, userPhoneNumber)
+	}
+
+	text := sms.message(userPhoneNumber, messages.AdminHelp, messages.Data{})
+	err = sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+// Lists the pending reservations of every user in the order they will be made
+func (sms *SMSHandler) handleAdminPendingSMS(userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"date_time": 1})
+	cursor, err := sms.db.Find(ctx, bson.M{"status": model.ReservationPending}, opts)
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving pending reservations")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	var reservations []model.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Reservations")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	language := sms.language(userPhoneNumber)
+	body := sms.messages.Render(language, messages.AdminNoPending, messages.Data{})
+	if len(reservations) > 0 {
+		lines := []string{sms.messages.Render(language, messages.AdminPending, messages.Data{})}
+		for i := range reservations {
+			owner := reservations[i].CreatedBy
+			if reservations[i].ReservationName != "" {
+				owner = reservations[i].ReservationName + " " + owner
+			}
+			if len(sms.config.Communities) > 1 {
+				owner += " at " + sms.community(&reservations[i]).Name
+			}
+			lines = append(lines, sms.messages.Render(language, messages.AdminPendingEntry, messages.Data{Summary: sms.formatReservation(&reservations[i], language), Name: owner}))
+		}
+		body = strings.Join(lines, "\n")
+	}
+
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) handleAdminCancelSMS(command string, userPhoneNumber string) error {
+	id, err := util.GetReservationId(command)
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.AdminInvalidCancel, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	// Booked reservations are released on Avalon as well, so that admins can free a court
+	return sms.cancelReservation(bson.M{"_id": id, "status": bson.M{"$in": []string{model.ReservationPending, model.ReservationBooked}}}, userPhoneNumber)
+}
+
+func (sms *SMSHandler) handleAdminPauseSMS(userPhoneNumber string) error {
+	key := messages.SchedulerPaused
+	if sms.Pause() {
+		util.LogInfo(sms.logger, "Scheduler paused by "+userPhoneNumber)
+	} else {
+		key = messages.SchedulerAlreadyPaused
+	}
+
+	body := sms.message(userPhoneNumber, key, messages.Data{})
+
+	err := sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) handleAdminResumeSMS(userPhoneNumber string) error {
+	released, ok := sms.Resume()
+
+	key := messages.SchedulerNotPaused
+	if ok {
+		util.LogInfo(sms.logger, "Scheduler resumed by "+userPhoneNumber)
+		key = messages.SchedulerResumed
+	}
+
+	body := sms.message(userPhoneNumber, key, messages.Data{Count: released})
+
+	err := sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Signs in to Avalon with the account of every community to check the bot can still make reservations
+func (sms *SMSHandler) handleAdminLoginSMS(userPhoneNumber string) error {
+	language := sms.language(userPhoneNumber)
+	var lines []string
+	for _, community := range sms.config.Communities {
+		account := community.Account()
+		data := messages.Data{Username: account.Username, Community: community.Key}
+		key := messages.LoginSucceeded
+
+		err := sms.avalonClient(community.Key).CheckLogin(account)
+		if err != nil {
+			// The error is only logged, since it can hold pages and redirects from Avalon
+			util.LogError(sms.logger, err)
+			data.Reason = sms.messages.Render(language, loginFailureMessage(err), messages.Data{})
+			key = messages.LoginFailed
+		}
+		lines = append(lines, sms.messages.Render(language, key, data))
+	}
+
+	body := strings.Join(lines, "\n")
+	err := sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Moves a user to another community, i.e. "admin community +15555550123 waterfront"
+func (sms *SMSHandler) handleAdminCommunitySMS(command string, userPhoneNumber string) error {
+	fields := strings.Fields(command)
+	phoneNumber, err := util.GetPhoneNumber(command)
+
+	var community *model.AvalonDetails
+	if err == nil && len(fields) > 2 {
+		for i := range sms.config.Communities {
+			if sms.config.Communities[i].Key == fields[len(fields)-1] {
+				community = &sms.config.Communities[i]
+			}
+		}
+	}
+
+	if community == nil {
+		var keys []string
+		for _, c := range sms.config.Communities {
+			keys = append(keys, c.Key)
+		}
+		body := sms.message(userPhoneNumber, messages.AdminInvalidCommunity, messages.Data{Communities: strings.Join(keys, ", ")})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return smsErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := sms.users.UpdateOne(ctx, bson.M{"_id": phoneNumber}, bson.M{"$set": bson.M{"community": community.Key}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while updating community of user "+phoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	body := sms.message(userPhoneNumber, messages.AdminCommunitySet, messages.Data{Phone: phoneNumber, Community: community.Name})
+	if result.MatchedCount == 0 {
+		body = sms.message(userPhoneNumber, messages.UserNotFound, messages.Data{Phone: phoneNumber})
+	} else {
+		util.LogInfo(sms.logger, "User "+phoneNumber+" moved to community "+community.Key+" by "+userPhoneNumber)
+	}
+
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Pauses the scheduler so that reservations coming due are held instead of made. Returns false if it was already paused.
+func (sms *SMSHandler) Pause() bool {
+	sms.jobsMu.Lock()
+	defer sms.jobsMu.Unlock()
+
+	if sms.paused {
+		return false
+	}
+
+	sms.paused = true
+	return true
+}
+
+// Returns true while the scheduler is paused
+func (sms *SMSHandler) Paused() bool {
+	sms.jobsMu.Lock()
+	defer sms.jobsMu.Unlock()
+
+	return sms.paused
+}
+
+// Resumes the scheduler and makes the reservations that were held while it was paused.
+// Returns the number of held reservations and false if the scheduler was not paused.
+func (sms *SMSHandler) Resume() (int, bool) {
+	sms.jobsMu.Lock()
+	if !sms.paused {
+		sms.jobsMu.Unlock()
+		return 0, false
+	}
+
+	sms.paused = false
+	held := sms.held
+	sms.held = make(map[primitive.ObjectID]*heldJob)
+	sms.jobsMu.Unlock()
+
+	for _, job := range held {
+		go sms.runJob(job.reservation, job.collection)
+	}
+
+	return len(held), true
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"strings"
+	"time"
+)
+
+// Replies with the times an activity is still free on Avalon on a day, i.e. "avail rb tomorrow". An alias shared by
+// several amenities lists each of them, all read within one sign-in so that the reply is sent before Twilio times out.
+func (sms *SMSHandler) handleAvailSMS(body string, userPhoneNumber string) error {
+	community := sms.userCommunity(userPhoneNumber)
+	command := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body), util.Avail))
+
+	activities, err := sms.activities(community).Find(command)
+	if err != nil {
+		return sms.replyInvalidAvail(userPhoneNumber)
+	}
+
+	date, err := util.ParseDate(command, time.Now(), community.Loc)
+	if err != nil {
+		return sms.replyInvalidAvail(userPhoneNumber)
+	}
+
+	account, err := sms.avalonAccount(userPhoneNumber, community)
+	if err != nil {
+		return err
+	}
+
+	client := sms.avalonClient(community.Key)
+	session := getSession()
+	loginErr := client.Login(session, account)
+
+	var lines []string
+	for _, activity := range activities {
+		data := messages.Data{Activity: activity, Date: date.Format(util.HoursDateLayout)}
+
+		var slots []model.Slot
+		err := loginErr
+		if err == nil {
+			slots, err = client.Availability(activity, date, session)
+		}
+		if err != nil {
+			util.LogDebug(sms.logger, "Unable to check availability of "+activity+" for "+userPhoneNumber)
+			util.LogError(sms.logger, err)
+			lines = append(lines, sms.message(userPhoneNumber, messages.AvailabilityFailed, data))
+			continue
+		}
+
+		times := freeTimes(slots, time.Now(), community.Loc)
+		if len(times) == 0 {
+			lines = append(lines, sms.message(userPhoneNumber, messages.NoAvailableTimes, data))
+			continue
+		}
+
+		data.Times = strings.Join(times, ", ")
+		lines = append(lines, sms.message(userPhoneNumber, messages.AvailableTimes, data))
+	}
+
+	text := strings.Join(lines, "\n")
+	err = sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) replyInvalidAvail(userPhoneNumber string) error {
+	text := sms.message(userPhoneNumber, messages.InvalidAvail, messages.Data{})
+	err := sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+	return nil
+}
+
+// Formats the start times of the slots that are neither taken nor already started, i.e. "7:00pm"
+func freeTimes(slots []model.Slot, now time.Time, loc *time.Location) []string {
+	var times []string
+	for _, slot := range slots {
+		if slot.Taken || slot.Start.Before(now) {
+			continue
+		}
+		times = append(times, slot.Start.In(loc).Format(util.RuleTimeLayout))
+	}
+	return times
+}
@@ -11,24 +11,85 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// AvalonClient books amenities on Avalon for one community. A booking is made in steps within one signed-in session:
+// Login, PrepareReservation to fill in the amenity's form, SubmitReservation to post it and ValidateReservation to
+// confirm that it is listed as upcoming. AvalonService implements it against the Avalon website.
+type AvalonClient interface {
+	Login(session *http.Client, account *model.AvalonAccount) error
+	PrepareReservation(r *model.Reservation, session *http.Client, account *model.AvalonAccount) (url.Values, error)
+	SubmitReservation(r *model.Reservation, session *http.Client, payload url.Values) error
+	ValidateReservation(r *model.Reservation, session *http.Client) error
+
+	MakeReservation(r *model.Reservation, account *model.AvalonAccount) (time.Time, error)
+	LinkAccount(account *model.AvalonAccount) error
+	CheckLogin(account *model.AvalonAccount) error
+	UpcomingReservations(account *model.AvalonAccount) ([]model.Reservation, error)
+	CancelReservation(r *model.Reservation, account *model.AvalonAccount) error
+	Availability(activity string, date time.Time, session *http.Client) ([]model.Slot, error)
+}
+
 type AvalonService struct {
 	Logger        *logrus.Logger
 	AvalonDetails model.AvalonDetails
-	HttpClient    *http.Client
 }
 
-func (as *AvalonService) MakeReservation(r *model.Reservation) error {
+// Returns the address of the page at path on the community's Avalon website
+func (as *AvalonService) url(path string) string {
+	baseUrl := as.AvalonDetails.BaseUrl
+	if baseUrl == "" {
+		baseUrl = util.AvalonBaseUrl
+	}
+	return strings.TrimSuffix(baseUrl, "/") + path
+}
+
+// MakeReservation tries the date/time of the reservation and then each of its fallback times within the same session.
+// Returns the date/time that was secured, or the BookingError of the step that failed.
+func (as *AvalonService) MakeReservation(r *model.Reservation, account *model.AvalonAccount) (time.Time, error) {
 	session := getSession()
-	err := as.login(session)
-	payload, err := as.prepareReservation(r, session)
-	err = as.submitReservation(r, session, payload)
-	err = as.validateReservation(r, session)
-	return err
+	err := as.Login(session, account)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, dateTime := range r.Slots() {
+		slot := *r
+		slot.Datetime = dateTime
+
+		err = as.makeSlot(&slot, session, account)
+		if err == nil {
+			return dateTime, nil
+		}
+
+		// Only a taken slot is worth trying the next option for, the other failures would repeat
+		if reason, _ := bookingFailure(err); reason != BookingSlotTaken {
+			return time.Time{}, err
+		}
+
+		util.LogInfo(as.Logger, "Unable to secure "+r.Activity+" at "+dateTime.In(as.AvalonDetails.Loc).Format(util.ReservationDateTimeLayout)+". Trying next option...")
+	}
+
+	return time.Time{}, err
+}
+
+// Prepares, submits and validates the reservation at its date/time
+func (as *AvalonService) makeSlot(r *model.Reservation, session *http.Client, account *model.AvalonAccount) error {
+	payload, err := as.PrepareReservation(r, session, account)
+	if err != nil {
+		return err
+	}
+
+	err = as.SubmitReservation(r, session, payload)
+	if err != nil {
+		return err
+	}
+
+	return as.ValidateReservation(r, session)
 }
 
 func getSession() *http.Client {
@@ -40,90 +101,170 @@ func getSession() *http.Client {
 	return client
 }
 
-func (as *AvalonService) login(session *http.Client) error {
-	htmlDoc, err := as.getHtmlDoc(session, util.AvalonLoginUrl)
-	userVerificationNode, err := as.getNode(htmlDoc, util.VerificationTokenXpath)
+// LinkAccount signs in to Avalon with the account and fills in its lease and person from the amenity reservation form.
+// The form of the first activity in alphabetical order is read, so every link checks the same page.
+func (as *AvalonService) LinkAccount(account *model.AvalonAccount) error {
+	var activities []string
+	for activity := range as.AvalonDetails.Amenities {
+		activities = append(activities, activity)
+	}
+	if len(activities) == 0 {
+		return errors.New("no amenities configured to link account with")
+	}
+	sort.Strings(activities)
+	amenity := as.AvalonDetails.Amenities[activities[0]]
+
+	session := getSession()
+	err := as.Login(session, account)
 	if err != nil {
 		return err
 	}
 
-	userVerificationToken, err := getVerificationToken(userVerificationNode)
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenityPath+amenity.Key), StepLink)
+	if err != nil {
+		return err
+	}
+
+	leaseIdNode, err := as.getNode(htmlDoc, util.LeaseIdXpath)
+	if err != nil {
+		return bookingError(StepLink, BookingLayoutChanged, errors.New("unable to find lease of account "+account.Username))
+	}
+
+	personIdNode, err := as.getNode(htmlDoc, util.PersonIdXpath)
+	if err != nil {
+		return bookingError(StepLink, BookingLayoutChanged, errors.New("unable to find person of account "+account.Username))
+	}
+
+	account.LeaseId, err = getVerificationToken(leaseIdNode)
+	if err != nil {
+		return bookingError(StepLink, BookingLayoutChanged, err)
+	}
+
+	account.PersonId, err = getVerificationToken(personIdNode)
+	if err != nil {
+		return bookingError(StepLink, BookingLayoutChanged, err)
+	}
+
+	return nil
+}
+
+// Signs in to Avalon with the account to check that its credentials work
+func (as *AvalonService) CheckLogin(account *model.AvalonAccount) error {
+	return as.Login(getSession(), account)
+}
+
+// Login signs in to Avalon with the account, keeping the session's cookies for the following requests
+func (as *AvalonService) Login(session *http.Client, account *model.AvalonAccount) error {
+	loginUrl := as.url(util.AvalonLoginPath)
+	htmlDoc, err := as.getHtmlDoc(session, loginUrl, StepLogin)
 	if err != nil {
-		util.LogError(as.Logger, err)
 		return err
 	}
 
-	response, err := session.PostForm(util.AvalonLoginUrl, url.Values{
-		"UserName":                   {as.AvalonDetails.Username},
-		"password":                   {as.AvalonDetails.Password},
+	userVerificationToken, err := as.verificationToken(htmlDoc, StepLogin)
+	if err != nil {
+		return err
+	}
+
+	response, err := session.PostForm(loginUrl, url.Values{
+		"UserName":                   {account.Username},
+		"password":                   {account.Password},
 		"__RequestVerificationToken": {userVerificationToken},
 	})
 
 	if err != nil {
-		util.LogDebug(as.Logger, "Unable to make POST request for url: "+util.AvalonLoginUrl)
+		util.LogDebug(as.Logger, "Unable to make POST request for url: "+loginUrl)
 		util.LogError(as.Logger, err)
-		return err
+		return bookingError(StepLogin, BookingNetwork, err)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode >= 300 {
 		body, _ := ioutil.ReadAll(response.Body)
-		err = errors.New("HTTP Request failed for url: "+util.AvalonLoginUrl+" - Status Code: "+strconv.Itoa(response.StatusCode)+" - Message: "+string(body))
+		err = errors.New("HTTP Request failed for url: " + loginUrl + " - Status Code: " + strconv.Itoa(response.StatusCode) + " - Message: " + string(body))
 		util.LogError(as.Logger, err)
-		return err
+		return bookingError(StepLogin, BookingNetwork, err)
+	}
+
+	// A successful login redirects away from the login page, a rejected one shows the login form again
+	if response.Request.URL.Path == util.AvalonLoginPath {
+		err = errors.New("Avalon rejected the login of " + account.Username)
+		util.LogError(as.Logger, err)
+		return bookingError(StepLogin, BookingLoginRejected, err)
 	}
 
 	return nil
 }
 
-func (as *AvalonService) prepareReservation(rsvp *model.Reservation, session *http.Client) (url.Values, error) {
+// PrepareReservation fills in the reservation form of the amenity
+func (as *AvalonService) PrepareReservation(rsvp *model.Reservation, session *http.Client, account *model.AvalonAccount) (url.Values, error) {
 	amenity := as.AvalonDetails.Amenities[rsvp.Activity]
 
-	htmlDoc, err := as.getHtmlDoc(session, util.AvalonAmenityUrl+amenity.Key)
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenityPath+amenity.Key), StepPrepare)
 	if err != nil {
 		return nil, err
 	}
 
-	amenityVerificationNode, err := as.getNode(htmlDoc, util.VerificationTokenXpath)
+	amenityVerificationToken, err := as.verificationToken(htmlDoc, StepPrepare)
 	if err != nil {
 		return nil, err
 	}
 
-	amenityVerificationToken, err := getVerificationToken(amenityVerificationNode)
-
-	if err != nil {
-		util.LogError(as.Logger, err)
-		return nil, err
-	}
-
-	payload := as.createPayload(rsvp, amenity, amenityVerificationToken)
+	payload := as.createPayload(rsvp, amenity, account, amenityVerificationToken)
 	return payload, nil
 }
 
-func (as *AvalonService) getHtmlDoc(session *http.Client, url string) (string, error) {
+// Returns the page at url. Failures are BookingErrors of the step.
+func (as *AvalonService) getHtmlDoc(session *http.Client, url string, step string) (string, error) {
 	response, err := session.Get(url)
 
 	if err != nil {
 		util.LogDebug(as.Logger, "Unable to make GET request for url: "+url)
 		util.LogError(as.Logger, err)
-		return "", err
+		return "", bookingError(step, BookingNetwork, err)
 	}
 
 	defer response.Body.Close()
 
-	body, _ := ioutil.ReadAll(response.Body)
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		util.LogError(as.Logger, err)
+		return "", bookingError(step, BookingNetwork, err)
+	}
 
 	if response.StatusCode >= 300 {
-		body, _ := ioutil.ReadAll(response.Body)
-		err = errors.New("HTTP Request failed for url: "+url+" - Status Code: "+strconv.Itoa(response.StatusCode)+" - Message: "+string(body))
+		err = errors.New("HTTP Request failed for url: " + url + " - Status Code: " + strconv.Itoa(response.StatusCode) + " - Message: " + string(body))
 		util.LogError(as.Logger, err)
-		return "", err
+		return "", bookingError(step, BookingNetwork, err)
+	}
+
+	// Pages that need a session redirect to the login page once Avalon has signed it out
+	if step != StepLogin && response.Request.URL.Path == util.AvalonLoginPath {
+		err = errors.New("Avalon signed out the session requesting url: " + url)
+		util.LogError(as.Logger, err)
+		return "", bookingError(step, BookingLoginRejected, err)
 	}
 
 	return string(body), nil
 }
 
+// Returns the __RequestVerificationToken of the form on the page
+func (as *AvalonService) verificationToken(htmlDoc string, step string) (string, error) {
+	node, err := as.getNode(htmlDoc, util.VerificationTokenXpath)
+	if err != nil {
+		return "", bookingError(step, BookingTokenMissing, err)
+	}
+
+	token, err := getVerificationToken(node)
+	if err != nil {
+		util.LogError(as.Logger, err)
+		return "", bookingError(step, BookingTokenMissing, err)
+	}
+
+	return token, nil
+}
+
 func getVerificationToken(node *html.Node) (string, error) {
 	for _, attribute := range node.Attr {
 		if attribute.Key == "value" {
@@ -144,8 +285,11 @@ func (as *AvalonService) getNode(html string, xPath string) (*html.Node, error)
 	}
 
 	nodes, err := htmlquery.QueryAll(doc, xPath)
+	if err == nil && len(nodes) == 0 {
+		err = errors.New("unable to find element with XPATH: " + xPath)
+	}
 
-	if err != nil || len(nodes) == 0 {
+	if err != nil {
 		util.LogDebug(as.Logger, "Unable to find element with XPATH: "+xPath)
 		util.LogError(as.Logger, err)
 		return nil, err
@@ -154,128 +298,363 @@ func (as *AvalonService) getNode(html string, xPath string) (*html.Node, error)
 	return nodes[0], nil
 }
 
-func (as *AvalonService) getNodes(html string, xPath string) ([]*html.Node, error) {
-	doc, err := htmlquery.Parse(strings.NewReader(html))
+// Returns the nodes of the reservations listed on the Amenities page, which may be none. Failures are BookingErrors of
+// the step.
+func (as *AvalonService) getUpcomingReservationNodes(htmlDoc string, step string) ([]*html.Node, error) {
+	if _, err := as.getNode(htmlDoc, util.UpcomingReservationsListXpath); err != nil {
+		return nil, bookingError(step, BookingLayoutChanged, err)
+	}
 
+	doc, err := htmlquery.Parse(strings.NewReader(htmlDoc))
 	if err != nil {
-		util.LogError(as.Logger, "Unable to parse HTML document")
-		util.LogError(as.Logger, err)
-		return nil, err
+		return nil, bookingError(step, BookingLayoutChanged, err)
 	}
 
-	nodes, err := htmlquery.QueryAll(doc, xPath)
-
-	if err != nil || len(nodes) == 0 {
-		util.LogDebug(as.Logger, "Unable to find elements with XPATH: "+xPath)
+	nodes, err := htmlquery.QueryAll(doc, util.UpcomingReservationsXpath)
+	if err != nil {
 		util.LogError(as.Logger, err)
+		return nil, bookingError(step, BookingLayoutChanged, err)
+	}
 
-		return nil, err
+	for _, node := range nodes {
+		if getUpcomingReservationAmenity(node) == "" || getUpcomingReservationAmenityDetails(node) == "" {
+			err = errors.New("unable to read upcoming reservation with XPATH: " + util.UpcomingReservationsXpath)
+			util.LogError(as.Logger, err)
+			return nil, bookingError(step, BookingLayoutChanged, err)
+		}
 	}
 
 	return nodes, nil
 }
 
-func (as *AvalonService) createPayload(rsvp *model.Reservation, amenity model.Amenity, amenityVerificationToken string) url.Values {
-	rsvpDateTime := rsvp.Datetime.In(util.Loc)
+func (as *AvalonService) createPayload(rsvp *model.Reservation, amenity model.Amenity, account *model.AvalonAccount, amenityVerificationToken string) url.Values {
+	rsvpDateTime := rsvp.Datetime.In(as.AvalonDetails.Loc)
 	rsvpDate := rsvpDateTime.Format("1/2/2006")
 	minDate := rsvpDateTime.Format("1/2/2006") + " 4:00:00 AM"
 	maxDate := rsvpDateTime.AddDate(0, 0, 1).Format("1/2/2006") + " 4:00:00 AM"
-	selStartTime := rsvpDateTime.Format("Monday-3:04 PM-") + rsvpDateTime.Add(1*time.Hour).Format("3:04 PM")
+	selStartTime := rsvpDateTime.Format("Monday-3:04 PM-") + rsvpDateTime.Add(rsvp.Length()).Format("3:04 PM")
 
 	payload := url.Values{
 		"__RequestVerificationToken": {amenityVerificationToken},
 		"AmenityKey":                 {amenity.Key},
 		"AmenityId":                  {amenity.Id},
 		"Id":                         {""},
-		"LeaseId":                    {as.AvalonDetails.LeaseId},
-		"PersonId":                   {as.AvalonDetails.PersonId},
+		"LeaseId":                    {account.LeaseId},
+		"PersonId":                   {account.PersonId},
 		"AmenityName":                {amenity.Name},
 		"ReservationMaxDate":         {maxDate},
 		"ReservationMinDate":         {minDate},
 		"TermsandConditions":         {"True"},
 		"Charge":                     {"0"},
 		"ReservationDate":            {rsvpDate},
-		"Notes":                      {""},
+		"Notes":                      {rsvp.Notes},
 		"SelStartTime":               {selStartTime},
-		"NumberOfPeople":             {"1"},
-		"ReservationNames":           {as.AvalonDetails.ReservationName},
+		"NumberOfPeople":             {strconv.Itoa(rsvp.Party())},
+		"ReservationNames":           {as.reservationNames(rsvp)},
 		"reservation-terms":          {"on"},
 	}
 
 	return payload
 }
 
-func (as *AvalonService) submitReservation(r *model.Reservation, session *http.Client, payload url.Values) error {
-	if !util.DateTimeWithinTwoDays(r.Datetime){
-		tom := time.Now().In(util.Loc).Add(24 * time.Hour)
-		schedulableTime := time.Date(tom.Year(), tom.Month(), tom.Day(), 0, 0, 0, 0, util.Loc)
-		dur := util.DurationFromNowInLoc(schedulableTime, util.Loc)
-		util.LogInfo(as.Logger, "Sleeping for "+string(dur.Milliseconds())+" milliseconds...")
+// Returns the names a reservation is made under, the user's display name followed by their guests
+func (as *AvalonService) reservationNames(rsvp *model.Reservation) string {
+	name := rsvp.ReservationName
+	if name == "" {
+		name = as.AvalonDetails.ReservationName
+	}
+
+	return strings.Join(append([]string{name}, rsvp.Guests...), ", ")
+}
+
+// SubmitReservation posts the reservation form, waiting for the booking window to open if it opens at the next midnight
+func (as *AvalonService) SubmitReservation(r *model.Reservation, session *http.Client, payload url.Values) error {
+	if r.Datetime.Before(time.Now()) {
+		err := errors.New("reservation for " + r.Activity + " at " + r.Datetime.String() + " is in the past")
+		util.LogError(as.Logger, err)
+		return bookingError(StepSubmit, BookingOutsideWindow, err)
+	}
+
+	if !util.DateTimeWithinBookingWindow(r.Datetime, as.AvalonDetails.Loc, as.AvalonDetails.BookingWindow()) {
+		tom := time.Now().In(as.AvalonDetails.Loc).Add(24 * time.Hour)
+		schedulableTime := time.Date(tom.Year(), tom.Month(), tom.Day(), 0, 0, 0, 0, as.AvalonDetails.Loc)
+		if !r.Datetime.Before(schedulableTime.AddDate(0, 0, as.AvalonDetails.BookingWindow())) {
+			err := errors.New("reservation for " + r.Activity + " at " + r.Datetime.String() + " is beyond the booking window")
+			util.LogError(as.Logger, err)
+			return bookingError(StepSubmit, BookingOutsideWindow, err)
+		}
+
+		dur := util.DurationFromNowInLoc(schedulableTime, as.AvalonDetails.Loc)
+		util.LogInfo(as.Logger, "Sleeping for "+strconv.FormatInt(dur.Milliseconds(), 10)+" milliseconds...")
 		time.Sleep(dur)
 	}
 
-	util.LogInfo(as.Logger, "Making reservation request for " + r.CreatedBy + " activity: " + r.Activity)
-	response, err := session.Post(util.AvalonSaveReservationUrl, "application/x-www-form-urlencoded", strings.NewReader(payload.Encode()))
+	util.LogInfo(as.Logger, "Making reservation request for "+r.CreatedBy+" activity: "+r.Activity)
+	saveReservationUrl := as.url(util.AvalonSaveReservationPath)
+	response, err := session.Post(saveReservationUrl, "application/x-www-form-urlencoded", strings.NewReader(payload.Encode()))
 
 	if err != nil {
-		util.LogDebug(as.Logger, "Unable to make POST request for url: "+util.AvalonSaveReservationUrl)
+		util.LogDebug(as.Logger, "Unable to make POST request for url: "+saveReservationUrl)
 		util.LogError(as.Logger, err)
-		return err
+		return bookingError(StepSubmit, BookingNetwork, err)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode >= 300 {
-		body, err := ioutil.ReadAll(response.Body)
-		err = errors.New("HTTP Request failed for url: "+util.AvalonSaveReservationUrl+" - Status Code: "+strconv.Itoa(response.StatusCode)+" - Message: "+string(body))
+		body, _ := ioutil.ReadAll(response.Body)
+		err = errors.New("HTTP Request failed for url: " + saveReservationUrl + " - Status Code: " + strconv.Itoa(response.StatusCode) + " - Message: " + string(body))
 		util.LogError(as.Logger, err)
-		return err
+		return bookingError(StepSubmit, BookingNetwork, err)
 	}
 
 	util.LogInfo(as.Logger, "Request has been posted successfully. Confirming request was accepted...")
 
-	return err
+	return nil
 }
 
-func (as *AvalonService) validateReservation(rsvp *model.Reservation, session *http.Client) error {
-	confirmed := false
-	rsvpDateTime := rsvp.Datetime.In(util.Loc)
-	htmlDoc, err := as.getHtmlDoc(session, util.AvalonAmenitiesUrl)
-
+// ValidateReservation confirms that the reservation is listed among the upcoming reservations. A submitted reservation
+// that is not listed was taken by someone else.
+func (as *AvalonService) ValidateReservation(rsvp *model.Reservation, session *http.Client) error {
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenitiesPath), StepValidate)
 	if err != nil {
 		return err
 	}
 
-	upcomingReservationsNodes, err := as.getNodes(htmlDoc, util.UpcomingReservationsXpath)
+	upcomingReservationsNodes, err := as.getUpcomingReservationNodes(htmlDoc, StepValidate)
 	if err != nil {
 		return err
 	}
 
 	for _, node := range upcomingReservationsNodes {
-		amenity := getUpcomingReservationAmenity(node)
-		if strings.Contains(amenity, as.AvalonDetails.Amenities[rsvp.Activity].Name) {
-			confirmationDateTime := getUpcomingReservationAmenityDetails(node)
-			rsvpDate := rsvpDateTime.Format("January 02, 2006")
-			rsvpStartTime := rsvpDateTime.Format("3:04 PM")
-			rsvpEndTime := rsvpDateTime.Add(1*time.Hour).Format("3:04 PM")
-			if strings.Contains(confirmationDateTime, rsvpDate) && strings.Contains(confirmationDateTime, rsvpStartTime) && strings.Contains(confirmationDateTime, rsvpEndTime) {
-				confirmed = true
-			}
+		if as.isUpcomingReservation(node, rsvp) {
+			return nil
 		}
 	}
 
-	if confirmed {
+	return bookingError(StepValidate, BookingSlotTaken, errors.New("failed to confirm reservation for "+rsvp.Activity+" at "+rsvp.Datetime.String()))
+}
+
+// CancelReservation cancels a booked reservation by finding it in the upcoming reservations and posting its
+// cancellation form
+func (as *AvalonService) CancelReservation(rsvp *model.Reservation, account *model.AvalonAccount) error {
+	session := getSession()
+	err := as.Login(session, account)
+	if err != nil {
+		return err
+	}
+
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenitiesPath), StepCancel)
+	if err != nil {
+		return err
+	}
+
+	upcomingReservationsNodes, err := as.getUpcomingReservationNodes(htmlDoc, StepCancel)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range upcomingReservationsNodes {
+		if !as.isUpcomingReservation(node, rsvp) {
+			continue
+		}
+
+		tokenNode := htmlquery.FindOne(node, util.CancelVerificationTokenXpath)
+		idNode := htmlquery.FindOne(node, util.CancelReservationIdXpath)
+		if tokenNode == nil || idNode == nil {
+			err = errors.New("unable to find cancellation form for reservation")
+			util.LogError(as.Logger, err)
+			return bookingError(StepCancel, BookingTokenMissing, err)
+		}
+
+		token, err := getVerificationToken(tokenNode)
+		if err != nil {
+			util.LogError(as.Logger, err)
+			return bookingError(StepCancel, BookingTokenMissing, err)
+		}
+
+		id, err := getVerificationToken(idNode)
+		if err != nil {
+			util.LogError(as.Logger, err)
+			return bookingError(StepCancel, BookingLayoutChanged, err)
+		}
+
+		util.LogInfo(as.Logger, "Cancelling reservation for "+rsvp.CreatedBy+" activity: "+rsvp.Activity)
+		cancelReservationUrl := as.url(util.AvalonCancelReservationPath)
+		response, err := session.PostForm(cancelReservationUrl, url.Values{
+			"__RequestVerificationToken": {token},
+			"Id":                         {id},
+		})
+
+		if err != nil {
+			util.LogDebug(as.Logger, "Unable to make POST request for url: "+cancelReservationUrl)
+			util.LogError(as.Logger, err)
+			return bookingError(StepCancel, BookingNetwork, err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(response.Body)
+			err = errors.New("HTTP Request failed for url: " + cancelReservationUrl + " - Status Code: " + strconv.Itoa(response.StatusCode) + " - Message: " + string(body))
+			util.LogError(as.Logger, err)
+			return bookingError(StepCancel, BookingNetwork, err)
+		}
+
 		return nil
 	}
 
-	return errors.New("failed to confirm reservation")
+	return errors.New("unable to find reservation to cancel")
 }
 
-func getUpcomingReservationAmenityDetails(node *html.Node) string {
-	return node.FirstChild.NextSibling.FirstChild.NextSibling.NextSibling.NextSibling.FirstChild.Data
+// Returns the booked reservations listed as upcoming for the account. A listing that names an amenity that is not
+// configured or that cannot be parsed fails the whole read, since a partial list would make the bookings left out look
+// cancelled.
+func (as *AvalonService) UpcomingReservations(account *model.AvalonAccount) ([]model.Reservation, error) {
+	session := getSession()
+	err := as.Login(session, account)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenitiesPath), StepUpcoming)
+	if err != nil {
+		return nil, err
+	}
+
+	upcomingReservationsNodes, err := as.getUpcomingReservationNodes(htmlDoc, StepUpcoming)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []model.Reservation
+	for _, node := range upcomingReservationsNodes {
+		amenityName := getUpcomingReservationAmenity(node)
+		activity := as.upcomingReservationActivity(amenityName)
+		if activity == "" {
+			err = errors.New("unknown amenity in upcoming reservations: " + amenityName)
+			util.LogError(as.Logger, err)
+			return nil, bookingError(StepUpcoming, BookingLayoutChanged, err)
+		}
+
+		dateTime, duration, err := util.ParseUpcomingDetails(getUpcomingReservationAmenityDetails(node), as.AvalonDetails.Loc)
+		if err != nil {
+			util.LogError(as.Logger, err)
+			return nil, bookingError(StepUpcoming, BookingLayoutChanged, err)
+		}
+
+		reservations = append(reservations, model.Reservation{
+			Datetime: dateTime,
+			Activity: activity,
+			Duration: duration,
+			Status:   model.ReservationBooked,
+		})
+	}
+
+	return reservations, nil
+}
+
+// Availability returns the slots the amenity reservation page of the activity offers on the day of date in the
+// community's timezone, both free and taken. The session must be signed in, so that one Login serves every amenity.
+func (as *AvalonService) Availability(activity string, date time.Time, session *http.Client) ([]model.Slot, error) {
+	amenity := as.AvalonDetails.Amenities[activity]
+	day := date.In(as.AvalonDetails.Loc).Format("1/2/2006")
+	htmlDoc, err := as.getHtmlDoc(session, as.url(util.AvalonAmenityPath+amenity.Key+util.AvalonAmenityDateParam+url.QueryEscape(day)), StepAvailability)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = as.getNode(htmlDoc, util.StartTimeSelectXpath); err != nil {
+		return nil, bookingError(StepAvailability, BookingLayoutChanged, err)
+	}
+
+	doc, err := htmlquery.Parse(strings.NewReader(htmlDoc))
+	if err != nil {
+		return nil, bookingError(StepAvailability, BookingLayoutChanged, err)
+	}
+
+	var slots []model.Slot
+	for _, option := range htmlquery.Find(doc, util.StartTimeOptionsXpath) {
+		value := htmlquery.SelectAttr(option, "value")
+		// The first option asks to pick a time
+		if value == "" {
+			continue
+		}
+
+		start, duration, err := util.ParseStartTimeOption(value, date, as.AvalonDetails.Loc)
+		if err != nil {
+			util.LogError(as.Logger, err)
+			return nil, bookingError(StepAvailability, BookingLayoutChanged, err)
+		}
+
+		slots = append(slots, model.Slot{Start: start, Duration: duration, Taken: hasAttr(option, "disabled")})
+	}
+
+	return slots, nil
+}
 
+func hasAttr(node *html.Node, key string) bool {
+	for _, attribute := range node.Attr {
+		if attribute.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the activity of the amenity named in an upcoming reservation, or an empty string if it is not configured.
+// Names are compared whole, so that "Tennis Court 10" is not taken for "Tennis Court 1".
+func (as *AvalonService) upcomingReservationActivity(amenityName string) string {
+	amenityName = strings.TrimSpace(amenityName)
+	for activity, amenity := range as.AvalonDetails.Amenities {
+		if amenityName == amenity.Name {
+			return activity
+		}
+	}
+	return ""
 }
 
+// Returns true if an upcoming reservation node is for exactly the amenity, start and length of the reservation
+func (as *AvalonService) isUpcomingReservation(node *html.Node, rsvp *model.Reservation) bool {
+	if as.upcomingReservationActivity(getUpcomingReservationAmenity(node)) != rsvp.Activity {
+		return false
+	}
+
+	start, duration, err := util.ParseUpcomingDetails(getUpcomingReservationAmenityDetails(node), as.AvalonDetails.Loc)
+	if err != nil {
+		return false
+	}
+
+	return start.Equal(rsvp.Datetime) && duration == rsvp.Length()
+}
+
+// Returns the date and times of an upcoming reservation node, or an empty string if the node has another structure
+func getUpcomingReservationAmenityDetails(node *html.Node) string {
+	return textAt(node, "fnfnnnf")
+}
+
+// Returns the amenity name of an upcoming reservation node, or an empty string if the node has another structure
 func getUpcomingReservationAmenity(node *html.Node) string {
-	return node.FirstChild.NextSibling.FirstChild.NextSibling.FirstChild.FirstChild.FirstChild.Data
+	return textAt(node, "fnfnfff")
+}
+
+// Returns the data of the node reached from node by following path, where f steps to the first child and n to the next
+// sibling. Returns an empty string if the path leads nowhere.
+func textAt(node *html.Node, path string) string {
+	for _, step := range path {
+		if node == nil {
+			return ""
+		}
+
+		if step == 'f' {
+			node = node.FirstChild
+		} else {
+			node = node.NextSibling
+		}
+	}
+
+	if node == nil {
+		return ""
+	}
+	return node.Data
 }
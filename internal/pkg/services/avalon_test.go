@@ -0,0 +1,340 @@
+package services
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/avalontest"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+)
+
+var fakeAccount = avalontest.Account{Username: "resident", Password: "secret", LeaseId: "lease-1", PersonId: "person-1"}
+
+// Returns an AvalonService booking against a fake Avalon website with a racquetball court and the fake account
+func newFakeAvalon(t *testing.T) (*avalontest.Server, *AvalonService) {
+	fake := avalontest.New()
+	fake.AddAccount(fakeAccount)
+	fake.AddAmenity("racquetball-key", "Racquetball Court")
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	loc, _ := time.LoadLocation("America/New_York")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	return fake, &AvalonService{
+		Logger: logger,
+		AvalonDetails: model.AvalonDetails{
+			Key:     "waterfront",
+			Loc:     loc,
+			BaseUrl: server.URL,
+			Amenities: map[string]model.Amenity{
+				"racquetball": {Key: "racquetball-key", Name: "Racquetball Court", Id: "6"},
+			},
+		},
+	}
+}
+
+// Returns the account the fake accepts, with its lease and person already linked
+func linkedAccount() *model.AvalonAccount {
+	return &model.AvalonAccount{Username: fakeAccount.Username, Password: fakeAccount.Password, LeaseId: fakeAccount.LeaseId, PersonId: fakeAccount.PersonId}
+}
+
+// Returns tomorrow at the hour in loc, which is always within the booking window
+func tomorrowAt(loc *time.Location, hour int) time.Time {
+	tomorrow := time.Now().In(loc).AddDate(0, 0, 1)
+	return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), hour, 0, 0, 0, loc).In(time.UTC)
+}
+
+// Takes the slot at dateTime on the fake's racquetball court for another resident
+func bookOther(fake *avalontest.Server, dateTime time.Time, loc *time.Location) {
+	local := dateTime.In(loc)
+	fake.Book(avalontest.Reservation{
+		Username:   "neighbour",
+		AmenityKey: "racquetball-key",
+		Date:       local.Format(util.UpcomingDateLayout),
+		StartTime:  local.Format(util.UpcomingTimeLayout),
+		EndTime:    local.Add(time.Hour).Format(util.UpcomingTimeLayout),
+	})
+}
+
+func TestMakeReservation(t *testing.T) {
+	tests := []struct {
+		name   string
+		taken  []int
+		want   int
+		booked bool
+	}{
+		{"Free slot", nil, 19, true},
+		{"Falls back to an alternative", []int{19}, 20, true},
+		{"All slots taken", []int{19, 20}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, as := newFakeAvalon(t)
+			loc := as.AvalonDetails.Loc
+			for _, hour := range tt.taken {
+				bookOther(fake, tomorrowAt(loc, hour), loc)
+			}
+
+			r := &model.Reservation{
+				Activity:        "racquetball",
+				Datetime:        tomorrowAt(loc, 19),
+				Alternatives:    []time.Time{tomorrowAt(loc, 20)},
+				CreatedBy:       "+15555550100",
+				ReservationName: "Sam",
+				Guests:          []string{"Alex"},
+				Notes:           "doubles",
+			}
+			got, err := as.MakeReservation(r, linkedAccount())
+
+			if !tt.booked {
+				if err == nil {
+					t.Fatalf("MakeReservation() = %v, want error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("MakeReservation() error = %v", err)
+			}
+			if want := tomorrowAt(loc, tt.want); !got.Equal(want) {
+				t.Errorf("MakeReservation() = %v, want %v", got, want)
+			}
+
+			held := fake.Reservations()
+			last := held[len(held)-1]
+			if last.Username != fakeAccount.Username || last.Names != "Sam, Alex" || last.People != 2 || last.Notes != "doubles" {
+				t.Errorf("Reservations() = %+v, want the booking of %v", last, fakeAccount.Username)
+			}
+		})
+	}
+}
+
+func TestUpcomingAndCancelReservation(t *testing.T) {
+	fake, as := newFakeAvalon(t)
+	loc := as.AvalonDetails.Loc
+	account := linkedAccount()
+
+	r := &model.Reservation{Activity: "racquetball", Datetime: tomorrowAt(loc, 9), Duration: 2 * time.Hour}
+	if _, err := as.MakeReservation(r, account); err != nil {
+		t.Fatalf("MakeReservation() error = %v", err)
+	}
+	bookOther(fake, tomorrowAt(loc, 12), loc)
+
+	upcoming, err := as.UpcomingReservations(account)
+	if err != nil {
+		t.Fatalf("UpcomingReservations() error = %v", err)
+	}
+	if len(upcoming) != 1 || upcoming[0].Activity != "racquetball" || !upcoming[0].Datetime.Equal(r.Datetime) || upcoming[0].Duration != r.Duration {
+		t.Fatalf("UpcomingReservations() = %+v, want the racquetball booking at %v", upcoming, r.Datetime)
+	}
+
+	if err = as.CancelReservation(r, account); err != nil {
+		t.Fatalf("CancelReservation() error = %v", err)
+	}
+	if held := fake.Reservations(); len(held) != 1 || held[0].Username != "neighbour" {
+		t.Errorf("Reservations() = %+v, want only the other resident's booking", held)
+	}
+
+	if err = as.CancelReservation(r, account); err == nil {
+		t.Errorf("CancelReservation() error = nil, want error for a reservation that is not upcoming")
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	_, as := newFakeAvalon(t)
+
+	account := &model.AvalonAccount{Username: fakeAccount.Username, Password: fakeAccount.Password}
+	if err := as.LinkAccount(account); err != nil {
+		t.Fatalf("LinkAccount() error = %v", err)
+	}
+	if account.LeaseId != fakeAccount.LeaseId || account.PersonId != fakeAccount.PersonId {
+		t.Errorf("LinkAccount() lease = %v, person = %v, want %v, %v", account.LeaseId, account.PersonId, fakeAccount.LeaseId, fakeAccount.PersonId)
+	}
+
+	if err := as.CheckLogin(account); err != nil {
+		t.Errorf("CheckLogin() error = %v", err)
+	}
+
+	err := as.CheckLogin(&model.AvalonAccount{Username: fakeAccount.Username, Password: "wrong"})
+	if reason, _ := bookingFailure(err); reason != BookingLoginRejected {
+		t.Errorf("CheckLogin() error = %v, want %v", err, BookingLoginRejected)
+	}
+	if key := loginFailureMessage(err); key != messages.LoginRejected {
+		t.Errorf("loginFailureMessage() = %v, want %v", key, messages.LoginRejected)
+	}
+}
+
+func TestCancelReservationExactMatch(t *testing.T) {
+	fake, as := newFakeAvalon(t)
+	loc := as.AvalonDetails.Loc
+	fake.AddAmenity("tennis1-key", "Tennis Court 1")
+	fake.AddAmenity("tennis10-key", "Tennis Court 10")
+	as.AvalonDetails.Amenities["tennis1"] = model.Amenity{Key: "tennis1-key", Name: "Tennis Court 1"}
+	as.AvalonDetails.Amenities["tennis10"] = model.Amenity{Key: "tennis10-key", Name: "Tennis Court 10"}
+
+	book := func(amenityKey string, start time.Time, length time.Duration) {
+		local := start.In(loc)
+		fake.Book(avalontest.Reservation{
+			Username:   fakeAccount.Username,
+			AmenityKey: amenityKey,
+			Date:       local.Format(util.UpcomingDateLayout),
+			StartTime:  local.Format(util.UpcomingTimeLayout),
+			EndTime:    local.Add(length).Format(util.UpcomingTimeLayout),
+		})
+	}
+	book("tennis10-key", tomorrowAt(loc, 13), time.Hour)
+	book("tennis1-key", tomorrowAt(loc, 13), 2*time.Hour)
+
+	tests := []struct {
+		name string
+		r    model.Reservation
+	}{
+		{"Amenity whose name contains the activity's", model.Reservation{Activity: "tennis1", Datetime: tomorrowAt(loc, 13), Duration: time.Hour}},
+		{"Same start but another length", model.Reservation{Activity: "tennis1", Datetime: tomorrowAt(loc, 13), Duration: 3 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := as.CancelReservation(&tt.r, linkedAccount()); err == nil {
+				t.Errorf("CancelReservation() error = nil, want error for a reservation that is not upcoming")
+			}
+		})
+	}
+
+	if held := fake.Reservations(); len(held) != 2 {
+		t.Fatalf("Reservations() = %+v, want both bookings kept", held)
+	}
+
+	r := &model.Reservation{Activity: "tennis1", Datetime: tomorrowAt(loc, 13), Duration: 2 * time.Hour}
+	if err := as.CancelReservation(r, linkedAccount()); err != nil {
+		t.Fatalf("CancelReservation() error = %v", err)
+	}
+	if held := fake.Reservations(); len(held) != 1 || held[0].AmenityKey != "tennis10-key" {
+		t.Errorf("Reservations() = %+v, want only the Tennis Court 10 booking", held)
+	}
+}
+
+func TestMakeReservationFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(fake *avalontest.Server, as *AvalonService)
+		account *model.AvalonAccount
+		hour    int
+		want    string
+		step    string
+	}{
+		{"Login rejected", nil, &model.AvalonAccount{Username: fakeAccount.Username, Password: "wrong"}, 19, BookingLoginRejected, StepLogin},
+		{"Slot taken", func(fake *avalontest.Server, as *AvalonService) {
+			bookOther(fake, tomorrowAt(as.AvalonDetails.Loc, 19), as.AvalonDetails.Loc)
+		}, linkedAccount(), 19, BookingSlotTaken, StepValidate},
+		{"Outside window", nil, linkedAccount(), -48, BookingOutsideWindow, StepSubmit},
+		{"Token missing", func(fake *avalontest.Server, as *AvalonService) {
+			as.AvalonDetails.BaseUrl = serve(t, `<html><body><form></form></body></html>`)
+		}, linkedAccount(), 19, BookingTokenMissing, StepLogin},
+		{"Network", func(fake *avalontest.Server, as *AvalonService) {
+			as.AvalonDetails.BaseUrl = "http://127.0.0.1:0"
+		}, linkedAccount(), 19, BookingNetwork, StepLogin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, as := newFakeAvalon(t)
+			if tt.setup != nil {
+				tt.setup(fake, as)
+			}
+
+			r := &model.Reservation{Activity: "racquetball", Datetime: tomorrowAt(as.AvalonDetails.Loc, tt.hour)}
+			_, err := as.MakeReservation(r, tt.account)
+			if reason, step := bookingFailure(err); reason != tt.want || step != tt.step {
+				t.Errorf("MakeReservation() error = %v, want %v at %v", err, tt.want, tt.step)
+			}
+		})
+	}
+}
+
+func TestLayoutChanged(t *testing.T) {
+	_, as := newFakeAvalon(t)
+
+	// Signed in, but the Amenities page no longer lists upcoming reservations where the bot reads them
+	fake := avalontest.New()
+	fake.AddAccount(fakeAccount)
+	mux := http.NewServeMux()
+	mux.Handle("/", fake)
+	mux.HandleFunc(util.AvalonAmenitiesPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div id="reservations"></div></body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	as.AvalonDetails.BaseUrl = server.URL
+
+	_, err := as.UpcomingReservations(linkedAccount())
+	if reason, step := bookingFailure(err); reason != BookingLayoutChanged || step != StepUpcoming {
+		t.Errorf("UpcomingReservations() error = %v, want %v at %v", err, BookingLayoutChanged, StepUpcoming)
+	}
+}
+
+func TestUpcomingReservationsUnknownAmenity(t *testing.T) {
+	fake, as := newFakeAvalon(t)
+	loc := as.AvalonDetails.Loc
+	fake.AddAmenity("pool-key", "Pool")
+	local := tomorrowAt(loc, 9).In(loc)
+	fake.Book(avalontest.Reservation{
+		Username:   fakeAccount.Username,
+		AmenityKey: "pool-key",
+		Date:       local.Format(util.UpcomingDateLayout),
+		StartTime:  local.Format(util.UpcomingTimeLayout),
+		EndTime:    local.Add(time.Hour).Format(util.UpcomingTimeLayout),
+	})
+
+	// A partial list would make the bookings left out look cancelled, so the account is not read at all
+	upcoming, err := as.UpcomingReservations(linkedAccount())
+	if reason, step := bookingFailure(err); reason != BookingLayoutChanged || step != StepUpcoming || upcoming != nil {
+		t.Errorf("UpcomingReservations() = %+v, %v, want %v at %v", upcoming, err, BookingLayoutChanged, StepUpcoming)
+	}
+}
+
+// Serves the page at every path, returning its URL
+func serve(t *testing.T, page string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestAvailability(t *testing.T) {
+	fake, as := newFakeAvalon(t)
+	loc := as.AvalonDetails.Loc
+	bookOther(fake, tomorrowAt(loc, 19), loc)
+
+	session := getSession()
+	if err := as.Login(session, linkedAccount()); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	slots, err := as.Availability("racquetball", tomorrowAt(loc, 0), session)
+	if err != nil {
+		t.Fatalf("Availability() error = %v", err)
+	}
+	if len(slots) != 24 {
+		t.Fatalf("Availability() = %d slots, want 24", len(slots))
+	}
+
+	for _, slot := range slots {
+		if want := slot.Start.Equal(tomorrowAt(loc, 19)); slot.Taken != want || slot.Duration != time.Hour {
+			t.Errorf("Availability() slot at %v taken = %v, duration = %v, want taken = %v for an hour", slot.Start.In(loc), slot.Taken, slot.Duration, want)
+		}
+	}
+
+	times := freeTimes(slots, tomorrowAt(loc, 18), loc)
+	if len(times) != 5 || times[0] != "6:00pm" || times[1] != "8:00pm" {
+		t.Errorf("freeTimes() = %v, want 6:00pm and 8:00pm to 11:00pm", times)
+	}
+}
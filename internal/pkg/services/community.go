@@ -0,0 +1,37 @@
+package services
+
+import (
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+)
+
+// Returns the community the user books in
+func (sms *SMSHandler) userCommunity(userPhoneNumber string) *model.AvalonDetails {
+	user, err := sms.getUser(userPhoneNumber)
+	if err != nil || user == nil {
+		return sms.config.Community("")
+	}
+
+	return sms.config.Community(user.Community)
+}
+
+// Returns the community the reservation is made in
+func (sms *SMSHandler) community(r *model.Reservation) *model.AvalonDetails {
+	return sms.config.Community(r.Community)
+}
+
+// Returns the AvalonClient that makes reservations in the community
+func (sms *SMSHandler) avalonClient(community string) AvalonClient {
+	return sms.avalonClients[sms.config.Community(community).Key]
+}
+
+// Returns the matcher for the activities and aliases of the community
+func (sms *SMSHandler) activities(community *model.AvalonDetails) *util.Activities {
+	return sms.activityMatchers[community.Key]
+}
+
+// Returns the help text listing the activities of the user's community
+func (sms *SMSHandler) helpText(userPhoneNumber string) string {
+	return sms.message(userPhoneNumber, messages.Help, messages.Data{Activities: sms.activities(sms.userCommunity(userPhoneNumber)).Describe()})
+}
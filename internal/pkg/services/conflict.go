@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How far back booked reservations are counted when the rotation policy picks whose turn it is
+const rotationWindow = 30 * 24 * time.Hour
+
+// How many open times a user is offered when they lose a slot
+const maxOpenTimes = 3
+
+// slotLocks serializes arbitrating and saving reservations for the same amenity on the same day, so that two requests
+// handled at once cannot both see the slot free and both be saved
+type slotLocks struct {
+	mu    sync.Mutex
+	locks map[string]*slotLock
+}
+
+type slotLock struct {
+	sync.Mutex
+	// holders counts the callers holding or waiting for the lock, which is dropped once there are none
+	holders int
+}
+
+// Locks the key and returns the function that unlocks it
+func (l *slotLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*slotLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &slotLock{}
+		l.locks[key] = lock
+	}
+	lock.holders++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		l.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Locks the amenity of the reservation for its day until the returned function is called. Hold it from arbitrating
+// a reservation until it is saved.
+func (sms *SMSHandler) lockSlot(r *model.Reservation) func() {
+	community := sms.community(r)
+	return sms.slots.lock(community.Key + "/" + r.Activity + "/" + r.Datetime.In(community.Loc).Format(util.RuleEndDateLayout))
+}
+
+// Decides between a reservation about to be saved and any other user's pending reservation for an overlapping time
+// of the same amenity, since only one of them can be made when the timers fire. The losing user is told right away
+// along with the times still open that day. Returns true if the reservation should be saved. Callers hold lockSlot
+// until the reservation is saved.
+func (sms *SMSHandler) arbitrateConflict(r *model.Reservation) (bool, error) {
+	community := sms.community(r)
+	sameDay, err := sms.pendingSameDay(r)
+	if err != nil {
+		return false, err
+	}
+
+	var existing *model.Reservation
+	for i := range sameDay {
+		if sameDay[i].CreatedBy != r.CreatedBy && overlaps(&sameDay[i], r) {
+			existing = &sameDay[i]
+			break
+		}
+	}
+
+	if existing == nil {
+		return true, nil
+	}
+
+	util.LogInfo(sms.logger, "Reservation for "+r.CreatedBy+" conflicts with reservation: "+existing.Id.Hex())
+
+	// A timer that already fired means the existing reservation is being made and can no longer be given up
+	if !sms.challengerWins(existing, r) || !sms.cancelJob(existing.Id) {
+		body := sms.message(r.CreatedBy, messages.SlotTaken, messages.Data{
+			Activity: r.Activity,
+			Date:     r.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout),
+			Times:    sms.openTimesMessage(r, sameDay),
+		})
+		err = sms.sendSMS(body, r.CreatedBy)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, r.CreatedBy, body)
+			return false, err
+		}
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dateTime := existing.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)
+	if existing.Replaces != nil {
+		// A move that loses keeps the booking it was going to release
+		lost := *existing
+		lost.Status = model.ReservationBooked
+		lost.Datetime = *existing.Replaces
+		lost.Alternatives = nil
+		lost.Replaces = nil
+		err = completeJob(ctx, &lost, sms.db, sms.logger)
+	} else {
+		err = removeJob(ctx, existing, sms.db, sms.logger)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var remaining []model.Reservation
+	for _, other := range sameDay {
+		if other.Id != existing.Id {
+			remaining = append(remaining, other)
+		}
+	}
+	remaining = append(remaining, *r)
+
+	body := sms.message(existing.CreatedBy, messages.SlotLost, messages.Data{Activity: existing.Activity, Date: dateTime, Times: sms.openTimesMessage(existing, remaining)})
+	err = sms.sendSMS(body, existing.CreatedBy)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, existing.CreatedBy, body)
+	}
+
+	return true, nil
+}
+
+// Returns the pending reservations of every user for the activity in the community on the day of the reservation
+func (sms *SMSHandler) pendingSameDay(r *model.Reservation) ([]model.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	community := sms.community(r)
+	start, end := util.DayBoundsUTC(r.Datetime, community.Loc)
+	cursor, err := sms.db.Find(ctx, bson.M{
+		"activity":  r.Activity,
+		"community": community.Key,
+		"status":    model.ReservationPending,
+		"date_time": bson.M{"$gte": start, "$lt": end},
+	})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving pending reservations for "+r.Activity)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	var reservations []model.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Reservations")
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// Applies the configured conflict policy. Returns true if the challenger takes the slot from the existing reservation.
+func (sms *SMSHandler) challengerWins(existing *model.Reservation, challenger *model.Reservation) bool {
+	policy := sms.community(challenger).ConflictPolicy
+
+	var existingCount, challengerCount int64
+	if policy == model.ConflictRotation {
+		var err error
+		if existingCount, err = sms.recentBookings(existing); err != nil {
+			return false
+		}
+		if challengerCount, err = sms.recentBookings(challenger); err != nil {
+			return false
+		}
+	}
+
+	return policyFavorsChallenger(policy, existingCount, challengerCount, rand.Intn)
+}
+
+// Returns true if the policy gives the slot to the challenger, given how many bookings each user had lately. draw
+// picks the lottery winner the way rand.Intn does.
+func policyFavorsChallenger(policy string, existingCount int64, challengerCount int64, draw func(n int) int) bool {
+	switch policy {
+	case model.ConflictLottery:
+		return draw(2) == 0
+	case model.ConflictRotation:
+		// Whoever has had fewer bookings lately gets their turn, ties go to whoever asked first
+		return challengerCount < existingCount
+	default:
+		return false
+	}
+}
+
+// Counts the reservations booked for the user of the reservation for its activity within the rotation window
+func (sms *SMSHandler) recentBookings(r *model.Reservation) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := sms.db.CountDocuments(ctx, bson.M{
+		"activity":   r.Activity,
+		"created_by": r.CreatedBy,
+		"status":     model.ReservationBooked,
+		"date_time":  bson.M{"$gte": time.Now().UTC().Add(-rotationWindow)},
+	})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while counting bookings for "+r.CreatedBy)
+		util.LogError(sms.logger, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Lists the valid start times closest to the reservation on the same day that do not overlap any of the taken
+// reservations, in the language of the user who made the reservation
+func (sms *SMSHandler) openTimesMessage(r *model.Reservation, taken []model.Reservation) string {
+	community := sms.community(r)
+	granularity := community.Amenities[r.Activity].Granularity()
+	start, end := util.DayBoundsUTC(r.Datetime, community.Loc)
+	now := time.Now().UTC()
+
+	var candidates []time.Time
+	for slot := start; slot.Before(end); slot = slot.Add(granularity) {
+		candidate := model.Reservation{Datetime: slot, Duration: r.Duration}
+		if slot.Equal(r.Datetime) || slot.Before(now) {
+			continue
+		}
+		if key, _ := invalidSlot(community, r.Activity, slot, r.Length()); key != "" {
+			continue
+		}
+
+		free := true
+		for i := range taken {
+			if overlaps(&taken[i], &candidate) {
+				free = false
+				break
+			}
+		}
+		if free {
+			candidates = append(candidates, slot)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return sms.message(r.CreatedBy, messages.NoOpenTimes, messages.Data{})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return absDuration(candidates[i].Sub(r.Datetime)) < absDuration(candidates[j].Sub(r.Datetime))
+	})
+	if len(candidates) > maxOpenTimes {
+		candidates = candidates[:maxOpenTimes]
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	var times []string
+	for _, candidate := range candidates {
+		times = append(times, candidate.In(community.Loc).Format(util.RuleTimeLayout))
+	}
+	return sms.message(r.CreatedBy, messages.OpenTimes, messages.Data{Times: strings.Join(times, ", ")})
+}
+
+// Returns true if the time ranges of two reservations overlap
+func overlaps(a *model.Reservation, b *model.Reservation) bool {
+	return a.Datetime.Before(b.Datetime.Add(b.Length())) && b.Datetime.Before(a.Datetime.Add(a.Length()))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stevetu717/racquetball-bot/model"
+)
+
+func TestPolicyFavorsChallenger(t *testing.T) {
+	heads := func(n int) int { return 0 }
+	tails := func(n int) int { return 1 }
+	tests := []struct {
+		name            string
+		policy          string
+		existingCount   int64
+		challengerCount int64
+		draw            func(n int) int
+		want            bool
+	}{
+		{"First come keeps the existing reservation", model.ConflictFirstCome, 5, 0, heads, false},
+		{"Unset policy is first come", "", 5, 0, heads, false},
+		{"Rotation favors fewer recent bookings", model.ConflictRotation, 3, 1, tails, true},
+		{"Rotation keeps the existing reservation with fewer bookings", model.ConflictRotation, 1, 3, heads, false},
+		{"Rotation tie goes to whoever asked first", model.ConflictRotation, 2, 2, heads, false},
+		{"Lottery draw for the challenger", model.ConflictLottery, 0, 5, heads, true},
+		{"Lottery draw for the existing reservation", model.ConflictLottery, 5, 0, tails, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyFavorsChallenger(tt.policy, tt.existingCount, tt.challengerCount, tt.draw); got != tt.want {
+				t.Errorf("policyFavorsChallenger() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2021, 3, 4, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		a    model.Reservation
+		b    model.Reservation
+		want bool
+	}{
+		{"Same time", model.Reservation{Datetime: at(19, 0), Duration: time.Hour}, model.Reservation{Datetime: at(19, 0), Duration: time.Hour}, true},
+		{"Starts during the other", model.Reservation{Datetime: at(19, 0), Duration: 2 * time.Hour}, model.Reservation{Datetime: at(20, 30), Duration: time.Hour}, true},
+		{"Back to back", model.Reservation{Datetime: at(19, 0), Duration: time.Hour}, model.Reservation{Datetime: at(20, 0), Duration: time.Hour}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaps(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("overlaps() = %v, want %v", got, tt.want)
+			}
+			if got := overlaps(&tt.b, &tt.a); got != tt.want {
+				t.Errorf("overlaps() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlotLocks(t *testing.T) {
+	var slots slotLocks
+
+	unlock := slots.lock("waterfront/racquetball/3/4/21")
+
+	// Another slot is not held up
+	slots.lock("waterfront/racquetball/3/5/21")()
+
+	acquired := make(chan struct{})
+	go func() {
+		slots.lock("waterfront/racquetball/3/4/21")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock() acquired a slot that is already held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock() did not acquire the slot once it was released")
+	}
+
+	if len(slots.locks) != 0 {
+		t.Errorf("locks = %v, want every released slot dropped", slots.locks)
+	}
+}
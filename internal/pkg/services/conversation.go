@@ -0,0 +1,57 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// How long a prompt waits for its reply before the reply is no longer interpreted in its context
+const conversationTTL = 10 * time.Minute
+
+// A prompt sent to a phone number waiting on a short reply such as YES/NO/1/2
+type conversation struct {
+	reply   func(answer string) error
+	expires time.Time
+}
+
+// ConversationStore keeps the prompt each phone number was last sent so short replies can be interpreted in context
+type ConversationStore struct {
+	conversations map[string]*conversation
+	ttl           time.Duration
+	mu            sync.Mutex
+}
+
+func NewConversationStore(ttl time.Duration) *ConversationStore {
+	return &ConversationStore{conversations: make(map[string]*conversation), ttl: ttl}
+}
+
+// Set replaces the prompt waiting on a reply from the phone number. Prompts that expired unanswered are dropped, so
+// the store only holds numbers prompted within the last ttl.
+func (cs *ConversationStore) Set(userPhoneNumber string, reply func(answer string) error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := time.Now()
+	for phoneNumber, c := range cs.conversations {
+		if now.After(c.expires) {
+			delete(cs.conversations, phoneNumber)
+		}
+	}
+
+	cs.conversations[userPhoneNumber] = &conversation{reply: reply, expires: now.Add(cs.ttl)}
+}
+
+// Take removes and returns the prompt waiting on a reply from the phone number, if it has not expired
+func (cs *ConversationStore) Take(userPhoneNumber string) (func(answer string) error, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c, ok := cs.conversations[userPhoneNumber]
+	delete(cs.conversations, userPhoneNumber)
+
+	if !ok || time.Now().After(c.expires) {
+		return nil, false
+	}
+
+	return c.reply, true
+}
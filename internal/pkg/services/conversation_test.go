@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConversationStore(t *testing.T) {
+	cs := NewConversationStore(time.Minute)
+	reply := func(answer string) error { return nil }
+
+	cs.Set("+15555550100", reply)
+	cs.conversations["+15555550100"].expires = time.Now().Add(-time.Second)
+	if _, ok := cs.Take("+15555550100"); ok {
+		t.Errorf("Take() returned an expired prompt")
+	}
+
+	cs.Set("+15555550101", reply)
+	cs.conversations["+15555550101"].expires = time.Now().Add(-time.Second)
+	cs.Set("+15555550102", reply)
+	if _, ok := cs.conversations["+15555550101"]; ok {
+		t.Errorf("Set() kept an expired prompt")
+	}
+
+	if _, ok := cs.Take("+15555550102"); !ok {
+		t.Errorf("Take() did not return the waiting prompt")
+	}
+	if _, ok := cs.Take("+15555550102"); ok {
+		t.Errorf("Take() returned a prompt that was already taken")
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+)
+
+// Reasons a request to Avalon can fail, the Reason of a BookingError
+const (
+	// BookingLoginRejected is Avalon refusing the account's credentials or signing the session out
+	BookingLoginRejected = "login_rejected"
+	// BookingTokenMissing is a page without the __RequestVerificationToken its form needs
+	BookingTokenMissing = "token_missing"
+	// BookingSlotTaken is a reservation that was submitted but is not listed as upcoming
+	BookingSlotTaken = "slot_taken"
+	// BookingOutsideWindow is a reservation in the past or too far ahead for its booking window to open in time
+	BookingOutsideWindow = "outside_window"
+	// BookingLayoutChanged is a page that no longer has the elements the bot reads
+	BookingLayoutChanged = "layout_changed"
+	// BookingNetwork is a request to Avalon that could not be made or that failed
+	BookingNetwork = "network"
+)
+
+// Steps of talking to Avalon, the Step of a BookingError
+const (
+	StepLogin        = "login"
+	StepPrepare      = "prepare"
+	StepSubmit       = "submit"
+	StepValidate     = "validate"
+	StepLink         = "link"
+	StepUpcoming     = "upcoming"
+	StepCancel       = "cancel"
+	StepAvailability = "availability"
+)
+
+// BookingError is why a step of talking to Avalon failed
+type BookingError struct {
+	Reason string
+	Step   string
+	Err    error
+}
+
+func (e *BookingError) Error() string {
+	return e.Step + ": " + e.Reason + ": " + e.Err.Error()
+}
+
+func (e *BookingError) Unwrap() error {
+	return e.Err
+}
+
+func bookingError(step string, reason string, err error) error {
+	return &BookingError{Reason: reason, Step: step, Err: err}
+}
+
+// Returns the reason and step of a BookingError, or empty strings for any other error
+func bookingFailure(err error) (string, string) {
+	var bookingErr *BookingError
+	if errors.As(err, &bookingErr) {
+		return bookingErr.Reason, bookingErr.Step
+	}
+	return "", ""
+}
+
+// Messages telling users why their reservation could not be made, by the reason it failed
+var bookingFailureMessages = map[string]string{
+	BookingLoginRejected: messages.FailedLoginRejected,
+	BookingTokenMissing:  messages.FailedSiteChanged,
+	BookingSlotTaken:     messages.FailedSlotTaken,
+	BookingOutsideWindow: messages.FailedOutsideWindow,
+	BookingLayoutChanged: messages.FailedSiteChanged,
+	BookingNetwork:       messages.FailedNetwork,
+}
+
+// Returns the key of the message telling the user why their reservation failed, the generic failure for errors that
+// are not from Avalon
+func bookingFailureMessage(err error) string {
+	reason, _ := bookingFailure(err)
+	if key, ok := bookingFailureMessages[reason]; ok {
+		return key
+	}
+	return messages.FailedReservation
+}
+
+// Reasons told to admins when signing in to Avalon fails, by the reason it failed
+var loginFailureMessages = map[string]string{
+	BookingLoginRejected: messages.LoginRejected,
+	BookingTokenMissing:  messages.LoginSiteChanged,
+	BookingLayoutChanged: messages.LoginSiteChanged,
+	BookingNetwork:       messages.LoginNetwork,
+}
+
+// Returns the key of the reason signing in to Avalon failed, the generic reason for errors that are not from Avalon
+func loginFailureMessage(err error) string {
+	reason, _ := bookingFailure(err)
+	if key, ok := loginFailureMessages[reason]; ok {
+		return key
+	}
+	return messages.LoginUnexpected
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"time"
+)
+
+func (sms *SMSHandler) handleLanguageSMS(body string, userPhoneNumber string) error {
+	fields := strings.Fields(body)
+	if len(fields) != 2 || !sms.messages.HasLanguage(fields[1]) {
+		text := sms.message(userPhoneNumber, messages.InvalidLanguage, messages.Data{Languages: strings.Join(sms.messages.Languages(), ", ")})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	language := strings.ToLower(fields[1])
+	_, err := sms.users.UpdateOne(ctx, bson.M{"_id": userPhoneNumber}, bson.M{"$set": bson.M{"language": language}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving language for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	text := sms.message(userPhoneNumber, messages.LanguageSet, messages.Data{Language: language})
+	err = sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+// Returns the language messages are sent to the user in
+func (sms *SMSHandler) language(userPhoneNumber string) string {
+	user, err := sms.getUser(userPhoneNumber)
+	if err != nil || user == nil || user.Language == "" {
+		return messages.DefaultLanguage
+	}
+
+	return user.Language
+}
+
+// Fills the message in the user's language
+func (sms *SMSHandler) message(userPhoneNumber string, key string, data messages.Data) string {
+	return sms.messages.Render(sms.language(userPhoneNumber), key, data)
+}
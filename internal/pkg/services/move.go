@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+func (sms *SMSHandler) handleMoveSMS(body string, userPhoneNumber string) error {
+	filter, newDateTime, err := sms.parseMoveSMS(body, userPhoneNumber, sms.userCommunity(userPhoneNumber))
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidMove, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return err
+	}
+
+	if newDateTime.Before(time.Now().UTC()) {
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation := model.Reservation{}
+	err = sms.db.FindOne(ctx, filter).Decode(&reservation)
+	if err == mongo.ErrNoDocuments {
+		util.LogInfo(sms.logger, "No reservation found to move for "+userPhoneNumber)
+		text := sms.message(userPhoneNumber, messages.MoveNotFound, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	} else if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while looking up reservation to move")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	community := sms.community(&reservation)
+	if key, data := invalidSlot(community, reservation.Activity, newDateTime, reservation.Length()); key != "" {
+		text := sms.message(userPhoneNumber, key, data)
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return errors.New("Invalid slot: " + newDateTime.In(community.Loc).Format("3:04 PM"))
+	}
+
+	oldDateTime := reservation.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)
+	newDateTimeLocal := newDateTime.In(community.Loc).Format(util.ReservationDateTimeLayout)
+
+	moved := reservation
+	moved.Datetime = newDateTime
+	moved.Alternatives = nil
+	moved.Status = model.ReservationPending
+	key := messages.MovedReservation
+	if reservation.Status == model.ReservationBooked {
+		// The new time is booked before the current booking is released, so a failed move leaves the user with their original time
+		previous := reservation.Datetime
+		moved.Replaces = &previous
+		key = messages.MovingReservation
+	}
+
+	// The new time is held to the same limits as a new request: one reservation per activity per day, and arbitrated
+	// against other users' reservations for the slot
+	conflict, err := sms.findDailyConflict(&moved)
+	if err != nil {
+		return err
+	}
+
+	if conflict != nil {
+		body = sms.message(userPhoneNumber, messages.DailyLimit, messages.Data{
+			Activity: conflict.Activity,
+			Date:     conflict.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout),
+			Status:   conflict.Status,
+		})
+		err = sms.sendSMS(body, userPhoneNumber)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+			return err
+		}
+		return nil
+	}
+
+	if reservation.Status == model.ReservationPending && !sms.cancelJob(reservation.Id) {
+		body := sms.message(userPhoneNumber, messages.MoveInProgress, messages.Data{Activity: reservation.Activity, Date: oldDateTime})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return smsErr
+		}
+		return nil
+	}
+
+	unlock := sms.lockSlot(&moved)
+	defer unlock()
+
+	won, err := sms.arbitrateConflict(&moved)
+	if err != nil || !won {
+		// The reservation keeps its original time, so it goes back on the scheduler
+		if reservation.Status == model.ReservationPending {
+			sms.ScheduleJob(&reservation, sms.db)
+		}
+		return err
+	}
+
+	body = sms.message(userPhoneNumber, key, messages.Data{Activity: reservation.Activity, OldDate: oldDateTime, NewDate: newDateTimeLocal})
+	reservation = moved
+
+	err = completeJob(ctx, &reservation, sms.db, sms.logger)
+	if err != nil {
+		text := sms.message(userPhoneNumber, messages.ReservationError, messages.Data{Id: reservation.Id.Hex()})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return err
+	}
+
+	sms.ScheduleJob(&reservation, sms.db)
+
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Builds the filter for the reservation to move and parses the date/time it is moving to.
+// The new date defaults to the date of the reservation when only a time is given. Dates and times are read in the
+// community's timezone.
+func (sms *SMSHandler) parseMoveSMS(body string, userPhoneNumber string, community *model.AvalonDetails) (bson.M, time.Time, error) {
+	loc := community.Loc
+	to := util.MoveToRegex.FindStringIndex(body)
+	if to == nil {
+		return nil, time.Time{}, errors.New("no new date/time provided to move to")
+	}
+
+	from, target := body[:to[0]], body[to[1]:]
+
+	activities, err := sms.activities(community).Find(from)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	oldDateTime, err := util.GetDateTimeUTC(from, loc)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if !util.DateRegex.MatchString(target) {
+		target = oldDateTime.In(loc).Format("1/2/06") + " " + target
+	}
+
+	newDateTime, err := util.GetDateTimeUTC(target, loc)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	filter := bson.M{
+		"activity":   bson.M{"$in": activities},
+		"date_time":  oldDateTime,
+		"created_by": userPhoneNumber,
+		"status":     bson.M{"$in": []string{model.ReservationPending, model.ReservationBooked}},
+	}
+
+	return filter, newDateTime, nil
+}
+
+// Releases the booking a moved reservation replaces, which was made under the Avalon account with the username
+// replacedAccount, and returns the message for the user
+func (sms *SMSHandler) releaseReplacedReservation(r *model.Reservation, replacedAccount string) string {
+	community := sms.community(r)
+	previous := *r
+	previous.Datetime = *r.Replaces
+	previous.Account = replacedAccount
+	previousDateTime := previous.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)
+	newDateTime := r.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)
+
+	account, err := sms.bookingAccount(&previous, community)
+	if err == nil {
+		err = sms.avalonClient(r.Community).CancelReservation(&previous, account)
+	}
+	if err != nil {
+		util.LogDebug(sms.logger, "FAIL: Failed to release previous Reservation on Avalon.com for reservation:"+r.Id.Hex())
+		util.LogError(sms.logger, err)
+		return sms.message(r.CreatedBy, messages.ReleaseFailed, messages.Data{Activity: r.Activity, NewDate: newDateTime, OldDate: previousDateTime})
+	}
+
+	return sms.message(r.CreatedBy, messages.MovedBookedReservation, messages.Data{Activity: r.Activity, NewDate: newDateTime, OldDate: previousDateTime})
+}
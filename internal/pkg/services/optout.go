@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Handles the carrier-standard STOP, START and HELP keywords. Returns true if the message was one of them.
+// YES only resubscribes numbers that have opted out, otherwise it is left to answer a pending confirmation.
+func (sms *SMSHandler) handleKeywordSMS(body string, userPhoneNumber string) (bool, error) {
+	keyword := strings.TrimSpace(body)
+
+	switch {
+	case containsKeyword(util.StopKeywords, keyword):
+		return true, sms.handleStopSMS(keyword, userPhoneNumber)
+	case containsKeyword(util.StartKeywords, keyword):
+		return true, sms.handleStartSMS(userPhoneNumber)
+	case keyword == util.Yes && sms.isOptedOut(userPhoneNumber):
+		return true, sms.handleStartSMS(userPhoneNumber)
+	case containsKeyword(util.HelpKeywords, keyword):
+		help := sms.helpText(userPhoneNumber)
+		err := sms.sendSMS(help, userPhoneNumber)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, help)
+			return true, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (sms *SMSHandler) handleStopSMS(keyword string, userPhoneNumber string) error {
+	// A bare "cancel" is most likely a cancel command missing its reservation, so its confirmation says how to get back
+	key := messages.OptedOut
+	if keyword == util.Cancel {
+		key = messages.OptedOutByCancel
+	}
+
+	// The confirmation is the last message the number receives so it is sent before the opt-out is recorded
+	text := sms.message(userPhoneNumber, key, messages.Data{})
+	err := sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	optOut := model.OptOut{Phone: userPhoneNumber, OptedOutAt: time.Now().UTC()}
+	_, err = sms.optOuts.ReplaceOne(ctx, bson.M{"_id": userPhoneNumber}, optOut, options.Replace().SetUpsert(true))
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving opt-out for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	util.LogInfo(sms.logger, userPhoneNumber+" has opted out")
+
+	return nil
+}
+
+func (sms *SMSHandler) handleStartSMS(userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := sms.optOuts.DeleteOne(ctx, bson.M{"_id": userPhoneNumber})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while removing opt-out for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	util.LogInfo(sms.logger, userPhoneNumber+" has opted back in")
+
+	text := sms.message(userPhoneNumber, messages.OptedIn, messages.Data{})
+	err = sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+// Returns true if the number has opted out. Numbers are treated as opted out if the list cannot be checked,
+// since texting someone who replied STOP is worse than a missed notification.
+func (sms *SMSHandler) isOptedOut(userPhoneNumber string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := sms.optOuts.FindOne(ctx, bson.M{"_id": userPhoneNumber}).Err()
+	if err == mongo.ErrNoDocuments {
+		return false
+	} else if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while checking opt-out for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+	}
+
+	return true
+}
+
+func containsKeyword(keywords []string, keyword string) bool {
+	for _, k := range keywords {
+		if k == keyword {
+			return true
+		}
+	}
+	return false
+}
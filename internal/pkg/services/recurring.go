@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
+)
+
+// Rules are expanded into a reservation once its booking window is less than this far away
+const ruleExpansionLead = 24 * time.Hour
+
+func (sms *SMSHandler) handleRecurringSMS(body string, userPhoneNumber string) error {
+	rule, err := sms.parseRecurringSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidRule, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return smsErr
+		}
+		return err
+	}
+
+	util.LogInfo(sms.logger, "Saving weekly rule to database...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = sms.rules.InsertOne(ctx, rule)
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving weekly rule to db")
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.ReservationError, messages.Data{Id: rule.Id.Hex()})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return smsErr
+		}
+		return err
+	}
+
+	body = sms.message(userPhoneNumber, messages.RuleSaved, messages.Data{Activity: rule.Activity, Weekday: rule.Weekday.String(), Time: formatRuleTime(rule), Id: rule.Id.Hex()})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	// The first occurrence may already be inside its booking window
+	sms.expandRule(ctx, rule)
+
+	return nil
+}
+
+func (sms *SMSHandler) parseRecurringSMS(body string, userPhoneNumber string) (*model.RecurringRule, error) {
+	community := sms.userCommunity(userPhoneNumber)
+	activities, err := sms.activities(community).Find(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Weekly rules are for one amenity, so a shared alias books the first of its amenities
+	activity := activities[0]
+
+	weekday, hour, minute, err := util.GetWeeklyTime(body)
+	if err != nil {
+		return nil, err
+	}
+
+	endDate, err := util.GetEndDate(body, community.Loc)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := util.GetDuration(body)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &model.RecurringRule{
+		Id:        primitive.NewObjectID(),
+		Activity:  activity,
+		Community: community.Key,
+		Weekday:   weekday,
+		Hour:      hour,
+		Minute:    minute,
+		Duration:  duration,
+		EndDate:   endDate,
+		CreatedBy: userPhoneNumber,
+	}
+
+	if rule.Duration == 0 {
+		rule.Duration = community.Amenities[activity].AllowedDurations()[0]
+	}
+
+	next := util.NextOccurrence(time.Now(), weekday, hour, minute, community.Loc)
+	if key, _ := invalidSlot(community, activity, next, rule.Duration); key != "" {
+		return nil, fmt.Errorf("invalid slot: %s for %s", formatRuleTime(rule), util.FormatDuration(rule.Duration))
+	}
+
+	return rule, nil
+}
+
+func (sms *SMSHandler) handleListRulesSMS(userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.rules.Find(ctx, bson.M{"created_by": userPhoneNumber})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving weekly rules for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	var rules []model.RecurringRule
+	if err = cursor.All(ctx, &rules); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to RecurringRules")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	language := sms.language(userPhoneNumber)
+	body := sms.messages.Render(language, messages.NoRules, messages.Data{})
+	if len(rules) > 0 {
+		lines := []string{sms.messages.Render(language, messages.ListRules, messages.Data{})}
+		for _, rule := range rules {
+			data := messages.Data{Activity: rule.Activity, Weekday: rule.Weekday.String(), Time: formatRuleTime(&rule), Id: rule.Id.Hex()}
+			if rule.EndDate != nil {
+				data.Until = rule.EndDate.In(sms.config.Community(rule.Community).Loc).Format(util.RuleEndDateLayout)
+			}
+			lines = append(lines, sms.messages.Render(language, messages.ListRule, data))
+		}
+		body = strings.Join(lines, "\n")
+	}
+
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) handleStopRuleSMS(body string, userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rule := model.RecurringRule{}
+	id, err := util.GetReservationId(body)
+	if err == nil {
+		err = sms.rules.FindOneAndDelete(ctx, bson.M{"_id": id, "created_by": userPhoneNumber}).Decode(&rule)
+		if err != nil && err != mongo.ErrNoDocuments {
+			util.LogDebug(sms.logger, "An error occurred while deleting weekly rule")
+			util.LogError(sms.logger, err)
+			return err
+		}
+	}
+
+	if err != nil {
+		util.LogInfo(sms.logger, "No weekly rule found to stop for "+userPhoneNumber)
+		text := sms.message(userPhoneNumber, messages.RuleNotFound, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	// Reservations already expanded from the rule are still pending, so take them out of the scheduler as well
+	cursor, err := sms.db.Find(ctx, bson.M{"rule_id": rule.Id, "status": model.ReservationPending})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving reservations of rule "+rule.Id.Hex())
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	var reservations []model.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Reservations")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	for _, r := range reservations {
+		if sms.cancelJob(r.Id) {
+			_ = removeJob(ctx, &r, sms.db, sms.logger)
+		}
+	}
+
+	body = sms.message(userPhoneNumber, messages.RuleStopped, messages.Data{Activity: rule.Activity, Weekday: rule.Weekday.String(), Time: formatRuleTime(&rule)})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Periodically expands every weekly rule whose next booking window is about to open
+func (sms *SMSHandler) StartRuleExpansion(ctx context.Context, interval time.Duration) {
+	sms.ExpandRules(ctx)
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sms.ExpandRules(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (sms *SMSHandler) ExpandRules(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.rules.Find(ctx, bson.D{})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving weekly rules")
+		util.LogError(sms.logger, err)
+		return
+	}
+
+	var rules []model.RecurringRule
+	if err = cursor.All(ctx, &rules); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to RecurringRules")
+		util.LogError(sms.logger, err)
+		return
+	}
+
+	for i := range rules {
+		sms.expandRule(ctx, &rules[i])
+	}
+}
+
+// Creates and schedules the next reservation of a rule once its booking window is within ruleExpansionLead
+func (sms *SMSHandler) expandRule(ctx context.Context, rule *model.RecurringRule) {
+	after := time.Now()
+	if rule.LastScheduled.After(after) {
+		after = rule.LastScheduled
+	}
+
+	community := sms.config.Community(rule.Community)
+	next := util.NextOccurrence(after, rule.Weekday, rule.Hour, rule.Minute, community.Loc)
+
+	if !sms.isApproved(rule.CreatedBy) {
+		util.LogInfo(sms.logger, "Skipping weekly rule "+rule.Id.Hex()+" of unapproved user "+rule.CreatedBy)
+		return
+	}
+
+	if rule.EndDate != nil && next.After(*rule.EndDate) {
+		util.LogInfo(sms.logger, "Weekly rule "+rule.Id.Hex()+" has ended. Removing it...")
+		_, err := sms.rules.DeleteOne(ctx, bson.M{"_id": rule.Id})
+		if err != nil {
+			util.LogDebug(sms.logger, "unable to delete weekly rule: "+rule.Id.Hex())
+			util.LogError(sms.logger, err)
+		}
+		return
+	}
+
+	if util.DurationUntilSchedulable(next, community.Loc, community.BookingWindow()) > ruleExpansionLead {
+		return
+	}
+
+	reservation := &model.Reservation{
+		Id:              primitive.NewObjectID(),
+		Datetime:        next,
+		Activity:        rule.Activity,
+		Community:       community.Key,
+		Duration:        rule.Duration,
+		CreatedBy:       rule.CreatedBy,
+		ReservationName: sms.displayName(rule.CreatedBy),
+		Status:          model.ReservationPending,
+		RuleId:          &rule.Id,
+	}
+
+	// Claim the occurrence before inserting it so that a rule expanded on save and by the ticker at the same time is
+	// only booked once
+	previous := rule.LastScheduled
+	result, err := sms.rules.UpdateOne(ctx, bson.M{"_id": rule.Id, "last_scheduled": previous}, bson.M{"$set": bson.M{"last_scheduled": next}})
+	if err != nil {
+		util.LogDebug(sms.logger, "unable to update weekly rule: "+rule.Id.Hex())
+		util.LogError(sms.logger, err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		util.LogInfo(sms.logger, "Weekly rule "+rule.Id.Hex()+" was already expanded for "+next.Format(time.RFC3339))
+		return
+	}
+	rule.LastScheduled = next
+
+	saved, err := sms.saveRuleReservation(ctx, rule, reservation)
+	if err != nil {
+		// Release the occurrence so that the next expansion tries again
+		_, err = sms.rules.UpdateOne(ctx, bson.M{"_id": rule.Id, "last_scheduled": next}, bson.M{"$set": bson.M{"last_scheduled": previous}})
+		if err != nil {
+			util.LogDebug(sms.logger, "unable to update weekly rule: "+rule.Id.Hex())
+			util.LogError(sms.logger, err)
+		}
+		rule.LastScheduled = previous
+		return
+	}
+
+	if saved {
+		sms.ScheduleJob(reservation, sms.db)
+	}
+}
+
+// Saves the reservation of a weekly rule under the same limits as a reservation requested by text: one per activity
+// per day, and arbitrated against other users' reservations for the slot. Returns false if the occurrence is skipped,
+// in which case the user has been told why.
+func (sms *SMSHandler) saveRuleReservation(ctx context.Context, rule *model.RecurringRule, r *model.Reservation) (bool, error) {
+	conflict, err := sms.findDailyConflict(r)
+	if err != nil {
+		return false, err
+	}
+
+	if conflict != nil {
+		util.LogInfo(sms.logger, "Skipping weekly rule "+rule.Id.Hex()+" on a day "+r.CreatedBy+" already has a reservation")
+		body := sms.message(r.CreatedBy, messages.DailyLimit, messages.Data{
+			Activity: conflict.Activity,
+			Date:     conflict.Datetime.In(sms.community(r).Loc).Format(util.ReservationDateTimeLayout),
+			Status:   conflict.Status,
+		})
+		if err = sms.sendSMS(body, r.CreatedBy); err != nil {
+			util.LogSMSError(sms.logger, err, r.CreatedBy, body)
+		}
+		return false, nil
+	}
+
+	unlock := sms.lockSlot(r)
+	defer unlock()
+
+	won, err := sms.arbitrateConflict(r)
+	if err != nil || !won {
+		return false, err
+	}
+
+	util.LogInfo(sms.logger, "Expanding weekly rule "+rule.Id.Hex()+" into reservation "+r.Id.Hex())
+
+	_, err = sms.db.InsertOne(ctx, r)
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving reservation of weekly rule "+rule.Id.Hex())
+		util.LogError(sms.logger, err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func formatRuleTime(rule *model.RecurringRule) string {
+	return time.Date(0, 1, 1, rule.Hour, rule.Minute, 0, 0, time.UTC).Format(util.RuleTimeLayout)
+}
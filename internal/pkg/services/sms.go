@@ -6,63 +6,250 @@ import (
 	"fmt"
 	"github.com/sfreiberg/gotwilio"
 	"github.com/sirupsen/logrus"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
 	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
 	"github.com/stevetu717/racquetball-bot/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type SMSHandler struct {
-	logger        *logrus.Logger
-	db            *mongo.Collection
-	twilio        *gotwilio.Twilio
-	avalonService *AvalonService
+	logger  *logrus.Logger
+	db      *mongo.Collection
+	rules   *mongo.Collection
+	users   *mongo.Collection
+	optOuts *mongo.Collection
+	// upcoming holds the reservations Avalon listed as upcoming at the last sync
+	upcoming *mongo.Collection
+	twilio   *gotwilio.Twilio
+	// avalonClients holds the AvalonClient of every community by its key
+	avalonClients map[string]AvalonClient
 	config        *model.Config
+	messages      *messages.Catalog
+	// activityMatchers recognizes the activities and aliases of every community by its key
+	activityMatchers map[string]*util.Activities
+
+	conversations *ConversationStore
+
+	// jobs holds the timer of every reservation waiting in the scheduler so that it can be stopped on cancel
+	jobs   map[primitive.ObjectID]*time.Timer
+	jobsMu sync.Mutex
+
+	// slots serializes arbitrating and saving pending reservations for the same amenity and day
+	slots slotLocks
+
+	// While paused, jobs whose timers fire are held until the scheduler is resumed
+	paused bool
+	held   map[primitive.ObjectID]*heldJob
 }
 
-func NewSMSHandler(logger *logrus.Logger, db *mongo.Collection, twilio *gotwilio.Twilio, avalonService *AvalonService, config *model.Config) *SMSHandler {
-	return &SMSHandler{logger, db, twilio, avalonService, config}
+// heldJob is a reservation whose timer fired while the scheduler was paused
+type heldJob struct {
+	reservation *model.Reservation
+	collection  *mongo.Collection
+}
+
+func NewSMSHandler(logger *logrus.Logger, db *mongo.Collection, rules *mongo.Collection, users *mongo.Collection, optOuts *mongo.Collection, upcoming *mongo.Collection, twilio *gotwilio.Twilio, avalonClients map[string]AvalonClient, config *model.Config, catalog *messages.Catalog) *SMSHandler {
+	activityMatchers := make(map[string]*util.Activities)
+	for _, community := range config.Communities {
+		aliases := make(map[string][]string)
+		for activity, amenity := range community.Amenities {
+			aliases[activity] = amenity.Aliases
+		}
+		activityMatchers[community.Key] = util.NewActivities(aliases)
+	}
+
+	return &SMSHandler{
+		logger:           logger,
+		db:               db,
+		rules:            rules,
+		users:            users,
+		optOuts:          optOuts,
+		upcoming:         upcoming,
+		twilio:           twilio,
+		avalonClients:    avalonClients,
+		config:           config,
+		messages:         catalog,
+		activityMatchers: activityMatchers,
+		conversations:    NewConversationStore(conversationTTL),
+		jobs:             make(map[primitive.ObjectID]*time.Timer),
+		held:             make(map[primitive.ObjectID]*heldJob),
+	}
 }
 
 func (sms *SMSHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	userPhoneNumber := r.FormValue("From")
-	body := strings.ToLower(r.FormValue("Body"))
+	rawBody := r.FormValue("Body")
+	body := strings.ToLower(rawBody)
 	util.LogInfo(sms.logger, "========== Received Text Message ==========")
 
 	util.LogInfo(sms.logger, "From: "+userPhoneNumber)
-	util.LogInfo(sms.logger, "Message: "+body)
+	util.LogInfo(sms.logger, "Message: "+util.RedactCredentials(body))
+
+	// Opt-out keywords are honoured for every number, registered or not
+	handled, err := sms.handleKeywordSMS(body, userPhoneNumber)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write([]byte("Internal Server Error"))
+		return
+	} else if handled {
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte("OK"))
+		return
+	}
 
-	if strings.Contains(body, "racquetball") ||
-		strings.Contains(body, "tennis1") ||
-		strings.Contains(body, "tennis2") ||
-		strings.Contains(body, "basketball") {
+	authorized, err := sms.authorize(body, rawBody, userPhoneNumber)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write([]byte("Internal Server Error"))
+		return
+	} else if !authorized {
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte("OK"))
+		return
+	}
+
+	// Commands are recognized without the note, so that words in a note cannot change what the message does
+	_, command := util.GetNotes(body)
+
+	if util.ShortReplyRegex.MatchString(command) {
+		err := sms.handleReplySMS(body, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Admin+" ") || strings.TrimSpace(command) == util.Admin {
+		err := sms.handleAdminSMS(body, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Cancel) {
+		util.LogInfo(sms.logger, "========== BEGIN CANCEL WORKFLOW ==========")
+		err := sms.handleCancelSMS(body, userPhoneNumber)
+		if err != nil {
+			util.LogInfo(sms.logger, "========== END CANCEL WORKFLOW ==========")
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.List) || strings.Contains(command, util.MyReservations) {
+		err := sms.handleListSMS(userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Avail) {
+		err := sms.handleAvailSMS(body, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Move) {
+		util.LogInfo(sms.logger, "========== BEGIN MOVE WORKFLOW ==========")
+		err := sms.handleMoveSMS(body, userPhoneNumber)
+		if err != nil {
+			util.LogInfo(sms.logger, "========== END MOVE WORKFLOW ==========")
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Name+" ") {
+		err := sms.handleNameSMS(rawBody, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Language) || strings.HasPrefix(strings.TrimSpace(command), util.Idioma) {
+		err := sms.handleLanguageSMS(body, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Approve) || strings.HasPrefix(strings.TrimSpace(command), util.Deny) {
+		status := model.UserApproved
+		if strings.HasPrefix(strings.TrimSpace(command), util.Deny) {
+			status = model.UserDenied
+		}
+		err := sms.handleApprovalSMS(body, userPhoneNumber, status)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Link+" ") {
+		err := sms.handleLinkSMS(rawBody, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.TrimSpace(command) == util.Unlink {
+		err := sms.handleUnlinkSMS(userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.Rules) {
+		err := sms.handleListRulesSMS(userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.HasPrefix(strings.TrimSpace(command), util.StopRule) {
+		err := sms.handleStopRuleSMS(body, userPhoneNumber)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if strings.Contains(command, " "+util.Every+" ") {
+		util.LogInfo(sms.logger, "========== BEGIN RECURRING WORKFLOW ==========")
+		err := sms.handleRecurringSMS(body, userPhoneNumber)
+		if err != nil {
+			util.LogInfo(sms.logger, "========== END RECURRING WORKFLOW ==========")
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("Internal Server Error"))
+			return
+		}
+	} else if sms.activities(sms.userCommunity(userPhoneNumber)).Contains(command) {
 		util.LogInfo(sms.logger, "========== BEGIN SCHEDULE WORKFLOW ==========")
-		err := sms.handleScheduleSMS(body, userPhoneNumber)
+		err := sms.handleScheduleSMS(rawBody, userPhoneNumber)
 		if err != nil {
 			util.LogInfo(sms.logger, "========== END SCHEDULE WORKFLOW ==========")
 			rw.WriteHeader(http.StatusInternalServerError)
 			_, _ = rw.Write([]byte("Internal Server Error"))
 			return
 		}
-	} else if strings.Contains(body, "assist") {
-		err := sms.sendSMS(util.SmsHelp, userPhoneNumber)
+	} else if strings.Contains(command, util.Assist) || strings.Contains(command, util.Help) {
+		help := sms.helpText(userPhoneNumber)
+		err := sms.sendSMS(help, userPhoneNumber)
 		if err != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.SmsHelp)
+			util.LogSMSError(sms.logger, err, userPhoneNumber, help)
 			rw.WriteHeader(http.StatusInternalServerError)
 			util.LogInfo(sms.logger, "========== END SCHEDULE WORKFLOW ==========")
 			_, _ = rw.Write([]byte("Internal Server Error"))
 			return
 		}
 	} else {
-		message := "Please enter a valid command to the avalon activity reservation system. Text 'assist' for help."
-		err := sms.sendSMS(message, userPhoneNumber)
+		err := sms.sendCommandHelp(userPhoneNumber)
 		if err != nil {
-			util.LogDebug(sms.logger, "unable to send sms: "+util.SmsHelp+" -  to: "+userPhoneNumber)
-			util.LogError(sms.logger, err)
 			util.LogInfo(sms.logger, "========== END SCHEDULE WORKFLOW ==========")
 			rw.WriteHeader(http.StatusInternalServerError)
 			_, _ = rw.Write([]byte("Internal Server Error"))
@@ -76,25 +263,183 @@ func (sms *SMSHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 }
 
 func (sms *SMSHandler) handleScheduleSMS(body string, userPhoneNumber string) error {
-	dateTime, activity, err := sms.parseScheduleSMS(body, userPhoneNumber)
+	reservation, err := sms.parseScheduleSMS(body, userPhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if reservation.Datetime.Before(time.Now().UTC()) {
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	conflict, err := sms.findDailyConflict(reservation)
+	if err != nil {
+		return err
+	}
+
+	if conflict != nil {
+		body = sms.message(userPhoneNumber, messages.DailyLimit, messages.Data{
+			Activity: conflict.Activity,
+			Date:     conflict.Datetime.In(sms.community(reservation).Loc).Format(util.ReservationDateTimeLayout),
+			Status:   conflict.Status,
+		})
+		err = sms.sendSMS(body, userPhoneNumber)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+			return err
+		}
+		return nil
+	}
+
+	// Nothing is saved or booked until the user confirms what was parsed from their message
+	sms.conversations.Set(userPhoneNumber, func(answer string) error {
+		return sms.handleConfirmReply(answer, reservation)
+	})
+
+	language := sms.language(userPhoneNumber)
+	body = sms.messages.Render(language, messages.ConfirmReservation, messages.Data{Summary: sms.formatSummary(reservation, language)})
+	err = sms.sendSMS(body, userPhoneNumber)
 	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
 		return err
 	}
 
-	reservation := &model.Reservation{Id: primitive.NewObjectID(), Datetime: dateTime, Activity: activity, CreatedBy: userPhoneNumber}
+	return nil
+}
+
+// Returns an existing reservation of the user for the same activity on the same day as any time of the reservation,
+// checking both reservations saved by the bot and the upcoming reservations last synced from Avalon. The reservation
+// itself and the booking a move replaces do not count, so a reservation can be moved to another time that day.
+func (sms *SMSHandler) findDailyConflict(r *model.Reservation) (*model.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	community := sms.community(r)
+
+	for _, slot := range r.Slots() {
+		start, end := util.DayBoundsUTC(slot, community.Loc)
+		existing := model.Reservation{}
+		err := sms.db.FindOne(ctx, bson.M{
+			"_id":        bson.M{"$ne": r.Id},
+			"activity":   r.Activity,
+			"created_by": r.CreatedBy,
+			"status":     bson.M{"$in": []string{model.ReservationPending, model.ReservationBooked}},
+			"date_time":  bson.M{"$gte": start, "$lt": end},
+		}).Decode(&existing)
+		if err == nil {
+			return &existing, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			util.LogDebug(sms.logger, "An error occurred while checking existing reservations for "+r.CreatedBy)
+			util.LogError(sms.logger, err)
+			return nil, err
+		}
+	}
+
+	// Bookings made on the Avalon website are read from the last sync rather than from Avalon, which is too slow to
+	// sign in to while Twilio waits for a reply
+	for _, slot := range r.Slots() {
+		start, end := util.DayBoundsUTC(slot, community.Loc)
+		dateTime := bson.M{"$gte": start, "$lt": end}
+		if r.Replaces != nil {
+			dateTime["$ne"] = *r.Replaces
+		}
+		upcoming := model.UpcomingReservation{}
+		err := sms.upcoming.FindOne(ctx, bson.M{
+			"community": community.Key,
+			"user":      r.CreatedBy,
+			"activity":  r.Activity,
+			"date_time": dateTime,
+		}).Decode(&upcoming)
+		if err == nil {
+			return &model.Reservation{Activity: upcoming.Activity, Datetime: upcoming.Datetime, Duration: upcoming.Duration, Status: model.ReservationBooked}, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			util.LogDebug(sms.logger, "An error occurred while checking upcoming Avalon reservations for "+r.CreatedBy)
+			util.LogError(sms.logger, err)
+			return nil, err
+		}
+	}
 
-	if dateTime.Before(time.Now().UTC()) {
-		smsErr := sms.sendSMS(util.SmsInvalidDateTime, userPhoneNumber)
+	return nil, nil
+}
+
+func (sms *SMSHandler) handleReplySMS(body string, userPhoneNumber string) error {
+	reply, ok := sms.conversations.Take(userPhoneNumber)
+	if !ok {
+		text := sms.message(userPhoneNumber, messages.NothingToConfirm, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
 		if smsErr != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.SmsInvalidDateTime)
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
 			return smsErr
 		}
-	} else if util.DateTimeWithinTwoDays(dateTime) {
-		util.LogInfo(sms.logger, "Reservation is within two days. Attempting to make reservation now...")
-		err := sms.avalonService.MakeReservation(reservation)
+		return nil
+	}
+
+	return reply(strings.TrimSpace(body))
+}
 
+func (sms *SMSHandler) handleConfirmReply(answer string, reservation *model.Reservation) error {
+	userPhoneNumber := reservation.CreatedBy
+
+	switch answer {
+	case util.Yes, "y", "1":
+		util.LogInfo(sms.logger, "========== BEGIN SCHEDULE WORKFLOW ==========")
+		defer util.LogInfo(sms.logger, "========== END SCHEDULE WORKFLOW ==========")
+		return sms.scheduleReservation(reservation)
+	case util.No, "n", "2":
+		text := sms.message(userPhoneNumber, messages.RequestDiscarded, messages.Data{})
+		err := sms.sendSMS(text, userPhoneNumber)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return err
+		}
+		return nil
+	}
+
+	sms.conversations.Set(userPhoneNumber, func(answer string) error {
+		return sms.handleConfirmReply(answer, reservation)
+	})
+
+	text := sms.message(userPhoneNumber, messages.ConfirmYesNo, messages.Data{})
+	err := sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+// Books a confirmed reservation right away if its booking window is open, otherwise saves it to the scheduler
+func (sms *SMSHandler) scheduleReservation(reservation *model.Reservation) error {
+	userPhoneNumber := reservation.CreatedBy
+
+	// Access may have been revoked while the request was waiting to be confirmed
+	if !sms.isApproved(userPhoneNumber) {
+		return errors.New("refusing to schedule reservation for unapproved user " + userPhoneNumber)
+	}
+
+	if reservation.Datetime.Before(time.Now().UTC()) {
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+	} else if community := sms.community(reservation); !sms.Paused() && util.DateTimeWithinBookingWindow(reservation.Datetime, community.Loc, community.BookingWindow()) {
+		util.LogInfo(sms.logger, "Reservation is within the booking window. Attempting to make reservation now...")
+		secured, err := sms.makeReservation(reservation)
+		sms.saveCompletedReservation(reservation, secured, err)
+
+		body := sms.reservationResultMessage(reservation, secured, err)
 		if err != nil {
-			body := fmt.Sprintf(util.SmsFailedReservation, reservation.Activity, reservation.Datetime.In(util.Loc).Format(util.ReservationDateTimeLayout))
 			util.LogError(sms.logger, body)
 			smsErr := sms.sendSMS(body, userPhoneNumber)
 			if smsErr != nil {
@@ -103,7 +448,6 @@ func (sms *SMSHandler) handleScheduleSMS(body string, userPhoneNumber string) er
 			}
 			return err
 		} else {
-			body := fmt.Sprintf(util.SmsSuccessfulReservation, reservation.Activity, reservation.Datetime.In(util.Loc).Format(util.ReservationDateTimeLayout))
 			smsErr := sms.sendSMS(body, userPhoneNumber)
 			if smsErr != nil {
 				util.LogSMSError(sms.logger, err, userPhoneNumber, body)
@@ -112,6 +456,15 @@ func (sms *SMSHandler) handleScheduleSMS(body string, userPhoneNumber string) er
 			util.LogInfo(sms.logger, body)
 		}
 	} else {
+		// While the scheduler is paused, reservations that could be made right away are saved and held like the rest
+		unlock := sms.lockSlot(reservation)
+		defer unlock()
+
+		won, err := sms.arbitrateConflict(reservation)
+		if err != nil || !won {
+			return err
+		}
+
 		util.LogInfo(sms.logger, "Saving reservation to database...")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -121,69 +474,508 @@ func (sms *SMSHandler) handleScheduleSMS(body string, userPhoneNumber string) er
 		if err != nil {
 			util.LogDebug(sms.logger, "An error occurred while saving reservation to db")
 			util.LogError(sms.logger, err)
-			smsErr := sms.sendSMS(util.ReservationError, userPhoneNumber)
+			text := sms.message(userPhoneNumber, messages.ReservationError, messages.Data{Id: reservation.Id.Hex()})
+			smsErr := sms.sendSMS(text, userPhoneNumber)
 			if smsErr != nil {
-				util.LogSMSError(sms.logger, err, userPhoneNumber, util.ReservationError)
+				util.LogSMSError(sms.logger, err, userPhoneNumber, text)
 				return smsErr
 			}
 			return err
 		}
 
-		sms.ScheduleJob(reservation, sms.db, sms.avalonService)
+		sms.ScheduleJob(reservation, sms.db)
 
-		err = sms.sendSMS(util.ReservationSaved, userPhoneNumber)
+		body := sms.message(userPhoneNumber, messages.ReservationSaved, messages.Data{Id: reservation.Id.Hex()})
+		err = sms.sendSMS(body, userPhoneNumber)
 		if err != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.ReservationSaved)
+			util.LogSMSError(sms.logger, err, userPhoneNumber, body)
 			return err
 		}
 	}
 	return nil
 }
 
-func (sms *SMSHandler) parseScheduleSMS(body string, userPhoneNumber string) (time.Time, string, error) {
-	dateTime, err := util.GetDateTimeUTC(body)
+// Parses a schedule request. Guest names are kept in the case they were sent in, everything else is matched in lower case.
+func (sms *SMSHandler) parseScheduleSMS(body string, userPhoneNumber string) (*model.Reservation, error) {
+	notes, body := util.GetNotes(strings.TrimSpace(body))
+	guests, body := util.GetGuests(strings.TrimSpace(body))
+	body = strings.ToLower(body)
+	partySize := util.GetPartySize(body)
+	body = util.PartySizeRegex.ReplaceAllString(body, "")
+	community := sms.userCommunity(userPhoneNumber)
+
+	dateTime, err := util.GetDateTimeUTC(body, community.Loc)
 
 	if err != nil {
 		util.LogError(sms.logger, err)
-		smsErr := sms.sendSMS(util.SmsInvalidDateTime, userPhoneNumber)
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
 		if smsErr != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.SmsInvalidDateTime)
-			return time.Time{}, "", smsErr
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return nil, smsErr
 		}
-		return time.Time{}, "", err
+		return nil, err
 	}
 
-	if dateTime.Hour() > 0 && dateTime.Hour() < 12 {
-		smsErr := sms.sendSMS(util.SmsInvalidDateTimeRange, userPhoneNumber)
+	alternatives, err := util.GetAlternativesUTC(body, dateTime, community.Loc)
+
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
 		if smsErr != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.SmsInvalidDateTimeRange)
-			return time.Time{}, "", smsErr
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return nil, smsErr
 		}
-		return time.Time{}, "", errors.New("Invalid time range: " + dateTime.In(util.Loc).Format("3:04 PM"))
+		return nil, err
 	}
 
-	activity, err := util.GetActivity(body)
+	activities, err := sms.activities(community).Find(body)
 
 	if err != nil {
 		util.LogError(sms.logger, err)
-		smsErr := sms.sendSMS(util.SmsInvalidActivity, userPhoneNumber)
+		text := sms.message(userPhoneNumber, messages.InvalidActivity, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return nil, smsErr
+		}
+		return nil, err
+	}
+
+	duration, err := util.GetDuration(body)
+
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidDateTime, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return nil, smsErr
+		}
+		return nil, err
+	}
+
+	activity := sms.freeActivity(community, activities, dateTime, duration)
+	if duration == 0 {
+		duration = community.Amenities[activity].AllowedDurations()[0]
+	}
+
+	reservation := &model.Reservation{
+		Id:              primitive.NewObjectID(),
+		Datetime:        dateTime,
+		Alternatives:    alternatives,
+		Activity:        activity,
+		Community:       community.Key,
+		Duration:        duration,
+		CreatedBy:       userPhoneNumber,
+		ReservationName: sms.displayName(userPhoneNumber),
+		Guests:          guests,
+		PartySize:       partySize,
+		Notes:           notes,
+		Status:          model.ReservationPending,
+	}
+
+	if utf8.RuneCountInString(notes) > util.AvalonNotesMaxLength {
+		body := sms.message(userPhoneNumber, messages.NotesTooLong, messages.Data{Max: util.AvalonNotesMaxLength})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return nil, smsErr
+		}
+		return nil, errors.New("Notes too long: " + strconv.Itoa(utf8.RuneCountInString(notes)) + " characters")
+	}
+
+	if capacity := community.Amenities[activity].MaxCapacity; capacity > 0 && reservation.Party() > capacity {
+		body := sms.message(userPhoneNumber, messages.InvalidPartySize, messages.Data{Activity: activity, Max: capacity})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
 		if smsErr != nil {
-			util.LogSMSError(sms.logger, err, userPhoneNumber, util.SmsInvalidActivity)
-			return time.Time{}, "", smsErr
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return nil, smsErr
 		}
-		return time.Time{}, "", err
+		return nil, errors.New("Invalid party size: " + strconv.Itoa(reservation.Party()))
 	}
-	return dateTime, activity, nil
+
+	for _, slot := range reservation.Slots() {
+		if key, data := invalidSlot(community, activity, slot, duration); key != "" {
+			text := sms.message(userPhoneNumber, key, data)
+			smsErr := sms.sendSMS(text, userPhoneNumber)
+			if smsErr != nil {
+				util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+				return nil, smsErr
+			}
+			return nil, errors.New("Invalid slot: " + slot.In(community.Loc).Format("3:04 PM") + " for " + util.FormatDuration(duration))
+		}
+	}
+
+	return reservation, nil
 }
 
-func (sms SMSHandler) getAction(body string) string {
+// Returns the first of the activities an alias stands for that no one has queued at dateTime, or the first activity
+// if they all are
+func (sms *SMSHandler) freeActivity(community *model.AvalonDetails, activities []string, dateTime time.Time, duration time.Duration) string {
+	if len(activities) == 1 {
+		return activities[0]
+	}
+
+	for _, activity := range activities {
+		candidate := &model.Reservation{Activity: activity, Community: community.Key, Datetime: dateTime, Duration: duration}
+		if duration == 0 {
+			candidate.Duration = community.Amenities[activity].AllowedDurations()[0]
+		}
+
+		pending, err := sms.pendingSameDay(candidate)
+		if err != nil {
+			continue
+		}
+
+		free := true
+		for i := range pending {
+			if overlaps(candidate, &pending[i]) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return activity
+		}
+	}
+
+	return activities[0]
+}
+
+// Returns the message and its fields explaining why a booking of the activity at dateTime for duration cannot be made
+// in the community, or "" if it can
+func invalidSlot(community *model.AvalonDetails, activity string, dateTime time.Time, duration time.Duration) (string, messages.Data) {
+	amenity := community.Amenities[activity]
+
+	local := dateTime.In(community.Loc)
+	hours := amenity.HoursOn(local)
+	if open, err := util.WithinOpeningHours(hours, dateTime, duration, community.Loc); err != nil || !open {
+		if strings.EqualFold(strings.TrimSpace(hours), util.ClosedHours) {
+			return messages.AmenityClosed, messages.Data{Activity: amenity.Name, Date: local.Format(util.HoursDateLayout)}
+		}
+		return messages.OutsideOpeningHours, messages.Data{Activity: amenity.Name, Hours: hours, Date: local.Format(util.HoursDateLayout)}
+	}
+
+	if !amenity.AllowsDuration(duration) {
+		var durations []string
+		for _, allowed := range amenity.AllowedDurations() {
+			durations = append(durations, util.FormatDuration(allowed))
+		}
+		return messages.InvalidDuration, messages.Data{Activity: activity, Lengths: strings.Join(durations, " or ")}
+	}
+
+	if !util.AlignedTo(dateTime, amenity.Granularity(), community.Loc) {
+		return messages.InvalidSlot, messages.Data{Activity: activity, Length: util.FormatDuration(amenity.Granularity())}
+	}
+
+	return "", messages.Data{}
+}
+
+func (sms *SMSHandler) handleCancelSMS(body string, userPhoneNumber string) error {
+	filter, err := sms.parseCancelSMS(body, userPhoneNumber, sms.userCommunity(userPhoneNumber))
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidCancel, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return smsErr
+		}
+		return err
+	}
+
+	return sms.cancelReservation(filter, userPhoneNumber)
+}
+
+// Cancels the pending or booked reservation matching the filter on behalf of the user. The owner of the reservation is
+// told separately when it is cancelled by someone else.
+func (sms *SMSHandler) cancelReservation(filter bson.M, userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation := model.Reservation{}
+	err := sms.db.FindOne(ctx, filter).Decode(&reservation)
+	if err == mongo.ErrNoDocuments {
+		util.LogInfo(sms.logger, "No reservation found to cancel for "+userPhoneNumber)
+		text := sms.message(userPhoneNumber, messages.CancelNotFound, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	} else if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while looking up reservation to cancel")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	if reservation.Status == model.ReservationBooked {
+		return sms.cancelBookedReservation(ctx, &reservation, userPhoneNumber)
+	}
+
+	loc := sms.community(&reservation).Loc
+	dateTime := reservation.Datetime.In(loc).Format(util.ReservationDateTimeLayout)
+
+	// A timer that already fired means MakeReservation is running, so the reservation can no longer be backed out of
+	if !sms.cancelJob(reservation.Id) {
+		body := sms.message(userPhoneNumber, messages.CancelInProgress, messages.Data{Activity: reservation.Activity, Date: dateTime})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return smsErr
+		}
+		return nil
+	}
+
+	key, data := messages.CancelledReservation, messages.Data{Activity: reservation.Activity, Date: dateTime}
+	if reservation.Replaces != nil {
+		// Cancelling a move keeps the booking that was going to be released
+		reservation.Status = model.ReservationBooked
+		reservation.Datetime = *reservation.Replaces
+		reservation.Alternatives = nil
+		reservation.Replaces = nil
+		err = completeJob(ctx, &reservation, sms.db, sms.logger)
+		key, data.OldDate = messages.CancelledMove, reservation.Datetime.In(loc).Format(util.ReservationDateTimeLayout)
+	} else {
+		err = removeJob(ctx, &reservation, sms.db, sms.logger)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if reservation.CreatedBy != userPhoneNumber {
+		util.LogInfo(sms.logger, "Reservation "+reservation.Id.Hex()+" was cancelled by "+userPhoneNumber)
+		notice := sms.message(reservation.CreatedBy, key, data)
+		smsErr := sms.sendSMS(notice, reservation.CreatedBy)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, reservation.CreatedBy, notice)
+		}
+		key, data = messages.AdminCancelled, messages.Data{Activity: reservation.Activity, Date: dateTime, Phone: reservation.CreatedBy}
+	}
+
+	body := sms.message(userPhoneNumber, key, data)
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Releases a booked reservation on Avalon, under the account it was made with, and forgets it
+func (sms *SMSHandler) cancelBookedReservation(ctx context.Context, r *model.Reservation, userPhoneNumber string) error {
+	community := sms.community(r)
+	key, data := messages.CancelledReservation, messages.Data{Activity: r.Activity, Date: r.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)}
+
+	account, err := sms.bookingAccount(r, community)
+
+	if r.Datetime.Before(time.Now()) {
+		key = messages.CancelNotFound
+	} else if err != nil {
+		util.LogDebug(sms.logger, "Unable to cancel reservation "+r.Id.Hex()+" without the Avalon account it was booked under")
+		util.LogError(sms.logger, err)
+		key = messages.CancelFailed
+	} else if err = sms.avalonClient(community.Key).CancelReservation(r, account); err != nil {
+		util.LogDebug(sms.logger, "FAIL: Failed to cancel Reservation on Avalon.com for reservation:"+r.Id.Hex())
+		util.LogError(sms.logger, err)
+		key = messages.CancelFailed
+	} else if err = removeJob(ctx, r, sms.db, sms.logger); err != nil {
+		return err
+	} else if r.CreatedBy != userPhoneNumber {
+		util.LogInfo(sms.logger, "Reservation "+r.Id.Hex()+" was cancelled by "+userPhoneNumber)
+		notice := sms.message(r.CreatedBy, key, data)
+		smsErr := sms.sendSMS(notice, r.CreatedBy)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, r.CreatedBy, notice)
+		}
+		key, data = messages.AdminCancelled, messages.Data{Activity: r.Activity, Date: data.Date, Phone: r.CreatedBy}
+	}
+
+	body := sms.message(userPhoneNumber, key, data)
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) handleListSMS(userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"date_time": 1})
+	// Past bookings stay in the database as history, but are no longer listed
+	cursor, err := sms.db.Find(ctx, bson.M{"created_by": userPhoneNumber, "date_time": bson.M{"$gt": time.Now().UTC()}}, opts)
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving reservations for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	var reservations []model.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Reservations")
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	// Bookings made on the Avalon website are known from the last sync
+	elsewhere, err := sms.bookedElsewhere(ctx, userPhoneNumber, reservations)
+	if err != nil {
+		return err
+	}
+
+	language := sms.language(userPhoneNumber)
+	body := sms.messages.Render(language, messages.NoReservations, messages.Data{})
+	if len(reservations) > 0 || len(elsewhere) > 0 {
+		lines := []string{sms.messages.Render(language, messages.ListReservations, messages.Data{})}
+		for _, r := range reservations {
+			lines = append(lines, sms.formatReservation(&r, language))
+		}
+		for _, r := range elsewhere {
+			date := r.Datetime.In(sms.config.Community(r.Community).Loc).Format(util.ReservationDateTimeLayout)
+			lines = append(lines, sms.messages.Render(language, messages.ListElsewhere, messages.Data{Activity: r.Activity, Date: date}))
+		}
+		body = strings.Join(lines, "\n")
+	}
+
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Describes a reservation and its status in the language for a list
+func (sms *SMSHandler) formatReservation(r *model.Reservation, language string) string {
+	data := messages.Data{Activity: r.Activity, Date: sms.formatSlots(r), Id: r.Id.Hex()}
+
+	switch r.Status {
+	case model.ReservationBooked:
+		return sms.messages.Render(language, messages.ListBooked, data)
+	case model.ReservationFailed:
+		return sms.messages.Render(language, messages.ListFailed, data)
+	case model.ReservationRemoved:
+		return sms.messages.Render(language, messages.ListRemoved, data)
+	default:
+		community := sms.community(r)
+		data.Time = time.Now().In(community.Loc).Add(util.DurationUntilSchedulable(r.Datetime, community.Loc, community.BookingWindow())).Format(util.ReservationDateTimeLayout)
+		return sms.messages.Render(language, messages.ListPending, data)
+	}
+}
+
+// Summarizes the amenity, day and hours of a reservation, i.e. "Racquetball Court, Thu Mar 4 7:00–8:00pm"
+func (sms *SMSHandler) formatSummary(r *model.Reservation, language string) string {
+	community := sms.community(r)
+	start := r.Datetime.In(community.Loc)
+	summary := fmt.Sprintf("%s, %s–%s", community.Amenities[r.Activity].Name, start.Format(util.SummaryDateTimeLayout), start.Add(r.Length()).Format(util.RuleTimeLayout))
+
+	if party := r.Party(); party > 1 {
+		summary += fmt.Sprintf(", %d people", party)
+		if len(r.Guests) > 0 {
+			summary += " with " + strings.Join(r.Guests, ", ")
+		}
+	}
+
+	if len(r.Alternatives) > 0 {
+		var alternatives []string
+		for _, alternative := range r.Alternatives {
+			alternatives = append(alternatives, alternative.In(community.Loc).Format(util.RuleTimeLayout))
+		}
+		summary += " (or " + strings.Join(alternatives, ", ") + ")"
+	}
+
+	if r.Notes != "" {
+		summary += ". " + sms.messages.Render(language, messages.ReservationNote, messages.Data{Note: r.Notes})
+	}
+
+	return summary
+}
+
+// Formats the date/time of a reservation followed by its fallback times, i.e. "3/4/21 7:00pm or 8:00pm"
+func (sms *SMSHandler) formatSlots(r *model.Reservation) string {
+	loc := sms.community(r).Loc
+	slots := []string{r.Datetime.In(loc).Format(util.ReservationDateTimeLayout)}
+	for _, alternative := range r.Alternatives {
+		slots = append(slots, alternative.In(loc).Format(util.RuleTimeLayout))
+	}
+
+	return strings.Join(slots, " or ")
+}
+
+// Tells the user who made the reservation whether it was made or why it was not, in their language
+func (sms *SMSHandler) reservationResultMessage(r *model.Reservation, secured time.Time, err error) string {
+	language := sms.language(r.CreatedBy)
+	if err != nil {
+		return sms.messages.Render(language, bookingFailureMessage(err), messages.Data{Activity: r.Activity, Date: sms.formatSlots(r)})
+	}
+
+	data := messages.Data{Activity: r.Activity, Date: secured.In(sms.community(r).Loc).Format(util.ReservationDateTimeLayout)}
+	body := sms.messages.Render(language, messages.SuccessfulReservation, data)
+	if !secured.Equal(r.Datetime) {
+		body = sms.messages.Render(language, messages.SuccessfulAlternative, data)
+	}
+
+	if r.Notes != "" {
+		body += " " + sms.messages.Render(language, messages.ReservationNote, messages.Data{Note: r.Notes})
+	}
+
+	return body
+}
+
+// Builds the filter for the reservation referenced by a cancel message, either by its ID or by activity and date/time
+// read in the community's timezone
+func (sms *SMSHandler) parseCancelSMS(body string, userPhoneNumber string, community *model.AvalonDetails) (bson.M, error) {
+	if id, err := util.GetReservationId(body); err == nil {
+		return bson.M{"_id": id, "created_by": userPhoneNumber, "status": bson.M{"$in": []string{model.ReservationPending, model.ReservationBooked}}}, nil
+	}
+
+	dateTime, err := util.GetDateTimeUTC(body, community.Loc)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := sms.activities(community).Find(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"activity": bson.M{"$in": activities}, "date_time": dateTime, "created_by": userPhoneNumber, "status": bson.M{"$in": []string{model.ReservationPending, model.ReservationBooked}}}, nil
+}
+
+func (sms *SMSHandler) getAction(body string) string {
 	if util.ContainsIgnoreCase(body, util.Schedule) {
 		return util.Schedule
 	}
 	return ""
 }
 
+func (sms *SMSHandler) sendCommandHelp(userPhoneNumber string) error {
+	text := sms.message(userPhoneNumber, messages.InvalidCommand, messages.Data{})
+	err := sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogDebug(sms.logger, "unable to send sms: "+text+" -  to: "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+	return nil
+}
+
 func (sms *SMSHandler) sendSMS(message string, userPhoneNumber string) error {
+	if sms.isOptedOut(userPhoneNumber) {
+		util.LogInfo(sms.logger, fmt.Sprintf("Not sending SMS '%s' to %s who has opted out", message, userPhoneNumber))
+		return nil
+	}
+
 	util.LogInfo(sms.logger, fmt.Sprintf("Sending SMS '%s' to %s", message, userPhoneNumber))
 	_, _, err := sms.twilio.SendMMS(sms.config.Twilio.PhoneNumber, userPhoneNumber, message, nil, "", "")
 	if err != nil {
@@ -192,40 +984,147 @@ func (sms *SMSHandler) sendSMS(message string, userPhoneNumber string) error {
 	return nil
 }
 
-func (sms *SMSHandler) ScheduleJob(r *model.Reservation, collection *mongo.Collection, avalonService *AvalonService) {
-	duration := util.DurationUntilSchedulable(r.Datetime)
+func (sms *SMSHandler) ScheduleJob(r *model.Reservation, collection *mongo.Collection) {
+	community := sms.community(r)
+	duration := util.DurationUntilSchedulable(r.Datetime, community.Loc, community.BookingWindow())
 	timer := time.NewTimer(duration)
-	util.LogInfo(sms.logger, "Will attempt to make Reservation "+r.Id.Hex()+" on Avalon.com at "+time.Now().In(util.Loc).Add(duration).String())
+	util.LogInfo(sms.logger, "Will attempt to make Reservation "+r.Id.Hex()+" on Avalon.com at "+time.Now().In(community.Loc).Add(duration).String())
+
+	sms.jobsMu.Lock()
+	sms.jobs[r.Id] = timer
+	sms.jobsMu.Unlock()
 
 	go func() {
 		<-timer.C
-		ctx := context.Background()
-		util.LogInfo(sms.logger, "Attempting to make Reservation "+r.Id.Hex()+" on Avalon.com ...")
-		err := avalonService.MakeReservation(r)
-
-		if err != nil {
-			util.LogDebug(sms.logger, "FAIL: Failed to make Reservation on Avalon.com")
-			body := fmt.Sprintf(util.SmsFailedReservation, r.Activity, r.Datetime.In(util.Loc).Format(util.ReservationDateTimeLayout))
-			err = sms.sendSMS(body, r.CreatedBy)
-			if err != nil {
-				util.LogSMSError(sms.logger, err, r.CreatedBy, body)
-			}
-		} else {
-			util.LogInfo(sms.logger, "SUCCESS: Successfully made Reservation on Avalon.com for reservation:"+r.Id.Hex())
-			body := fmt.Sprintf(util.SmsSuccessfulReservation, r.Activity, r.Datetime.In(util.Loc).Format(util.ReservationDateTimeLayout))
-			err = sms.sendSMS(body, r.CreatedBy)
-			if err != nil {
-				util.LogSMSError(sms.logger, err, r.CreatedBy, body)
-			}
+		sms.jobsMu.Lock()
+		delete(sms.jobs, r.Id)
+		if sms.paused {
+			sms.held[r.Id] = &heldJob{reservation: r, collection: collection}
+			sms.jobsMu.Unlock()
+			util.LogInfo(sms.logger, "Scheduler is paused. Holding Reservation "+r.Id.Hex())
+			return
 		}
+		sms.jobsMu.Unlock()
+
+		sms.runJob(r, collection)
+	}()
+}
 
-		util.LogInfo(sms.logger, "Attempting to remove Reservation from database...")
-		err = removeJob(ctx, r, collection, sms.logger)
+// Makes a reservation whose timer has fired and records the outcome
+func (sms *SMSHandler) runJob(r *model.Reservation, collection *mongo.Collection) {
+	ctx := context.Background()
+	util.LogInfo(sms.logger, "Attempting to make Reservation "+r.Id.Hex()+" on Avalon.com ...")
+	// A move is booked under the user's current account, while the booking it replaces stays under its own
+	replacedAccount := r.Account
+	secured, err := sms.makeReservation(r)
+	body := sms.reservationResultMessage(r, secured, err)
 
-		if err == nil {
-			util.LogInfo(sms.logger, "SUCCESS: Removed Reservation from database")
+	if err != nil {
+		reason, step := bookingFailure(err)
+		util.LogReservationError(sms.logger, err, r.Id.Hex(), step, reason)
+		r.Status = model.ReservationFailed
+		if r.Replaces != nil {
+			// The booking that was being moved is still held on Avalon
+			body = sms.message(r.CreatedBy, messages.MoveFailed, messages.Data{
+				Activity: r.Activity,
+				NewDate:  sms.formatSlots(r),
+				OldDate:  r.Replaces.In(sms.community(r).Loc).Format(util.ReservationDateTimeLayout),
+			})
+			r.Status = model.ReservationBooked
+			r.Datetime = *r.Replaces
+			r.Alternatives = nil
+			r.Replaces = nil
 		}
-	}()
+	} else {
+		util.LogInfo(sms.logger, "SUCCESS: Successfully made Reservation on Avalon.com for reservation:"+r.Id.Hex())
+		r.Status = model.ReservationBooked
+		r.Datetime = secured
+		if r.Replaces != nil {
+			body = sms.releaseReplacedReservation(r, replacedAccount)
+			r.Replaces = nil
+		}
+	}
+
+	err = sms.sendSMS(body, r.CreatedBy)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, r.CreatedBy, body)
+	}
+
+	util.LogInfo(sms.logger, "Attempting to update Reservation status in database...")
+	err = completeJob(ctx, r, collection, sms.logger)
+
+	if err == nil {
+		util.LogInfo(sms.logger, "SUCCESS: Updated Reservation status in database")
+	}
+}
+
+// Makes the reservation in its community under the Avalon account of the user who requested it
+func (sms *SMSHandler) makeReservation(r *model.Reservation) (time.Time, error) {
+	community := sms.community(r)
+	account, err := sms.avalonAccount(r.CreatedBy, community)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	secured, err := sms.avalonClient(community.Key).MakeReservation(r, account)
+	if err == nil {
+		r.Account = account.Username
+	}
+	return secured, err
+}
+
+// Stops the scheduler timer of a reservation. Returns false if the timer has already fired and the reservation is being made.
+func (sms *SMSHandler) cancelJob(id primitive.ObjectID) bool {
+	sms.jobsMu.Lock()
+	defer sms.jobsMu.Unlock()
+
+	if _, ok := sms.held[id]; ok {
+		delete(sms.held, id)
+		return true
+	}
+
+	timer, ok := sms.jobs[id]
+	if !ok {
+		return false
+	}
+
+	delete(sms.jobs, id)
+	return timer.Stop()
+}
+
+// Records the outcome of a reservation that was attempted right away so that it shows up in the user's list
+func (sms *SMSHandler) saveCompletedReservation(r *model.Reservation, secured time.Time, err error) {
+	r.Status = model.ReservationBooked
+	if err != nil {
+		r.Status = model.ReservationFailed
+	} else {
+		r.Datetime = secured
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = sms.db.InsertOne(ctx, r)
+	if err != nil {
+		util.LogDebug(sms.logger, "unable to save completed reservation: "+r.Id.Hex())
+		util.LogError(sms.logger, err)
+	}
+}
+
+func completeJob(ctx context.Context, reservation *model.Reservation, collection *mongo.Collection, logger *logrus.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": reservation.Id}, reservation)
+	if err != nil {
+		util.LogDebug(logger, "unable to update status of reservation: "+reservation.Id.Hex())
+		util.LogError(logger, err)
+		return err
+	}
+
+	util.LogInfo(logger, "Reservation: "+reservation.Id.Hex()+" is now "+reservation.Status)
+
+	return nil
 }
 
 func removeJob(ctx context.Context, reservation *model.Reservation, collection *mongo.Collection, logger *logrus.Logger) error {
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// Periodically reads back the upcoming reservations of every Avalon account bookings are made under. The first sync
+// runs in the background so that signing in to Avalon does not hold up startup.
+func (sms *SMSHandler) StartSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		sms.SyncUpcoming(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				sms.SyncUpcoming(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// SyncUpcoming records the reservations Avalon lists as upcoming for the community account and every linked account,
+// and tells users whose booked reservations are no longer listed under the account they were booked with
+func (sms *SMSHandler) SyncUpcoming(ctx context.Context) {
+	util.LogInfo(sms.logger, "========== BEGIN SYNC WORKFLOW ==========")
+	for i := range sms.config.Communities {
+		sms.syncCommunity(ctx, &sms.config.Communities[i])
+	}
+	util.LogInfo(sms.logger, "========== END SYNC WORKFLOW ==========")
+}
+
+func (sms *SMSHandler) syncCommunity(ctx context.Context, community *model.AvalonDetails) {
+	// owners maps an account's username to the user it belongs to, the community account belonging to no one
+	accounts := map[string]*model.AvalonAccount{community.Username: community.Account()}
+	owners := map[string]string{community.Username: ""}
+
+	linked, err := sms.linkedUsers(ctx, community)
+	if err != nil {
+		return
+	}
+
+	for _, user := range linked {
+		account, err := sms.avalonAccount(user.Phone, community)
+		if err != nil {
+			continue
+		}
+		accounts[account.Username] = account
+		owners[account.Username] = user.Phone
+	}
+
+	booked, err := sms.bookedReservations(ctx, community)
+	if err != nil {
+		return
+	}
+
+	// Bookings are also read back under the account they were made with when it no longer belongs to the community,
+	// i.e. its user has since moved, without recording the account's other reservations here
+	checked := make(map[string]*model.AvalonAccount)
+	for i := range booked {
+		r := &booked[i]
+		if _, ok := accounts[r.Account]; ok || r.Account == "" {
+			continue
+		}
+
+		account, err := sms.bookingAccount(r, community)
+		if err != nil {
+			util.LogInfo(sms.logger, "Unable to sync reservation "+r.Id.Hex()+" under Avalon account "+r.Account+": "+err.Error())
+			continue
+		}
+		checked[r.Account] = account
+		accounts[r.Account] = account
+	}
+
+	// listed holds the upcoming reservations of every account that could be read, by its username
+	listed := make(map[string][]model.UpcomingReservation)
+	for username, account := range accounts {
+		upcoming, err := sms.avalonClient(community.Key).UpcomingReservations(account)
+		if err != nil {
+			util.LogDebug(sms.logger, "Unable to sync upcoming Avalon reservations of "+username+" in "+community.Key)
+			util.LogError(sms.logger, err)
+			continue
+		}
+
+		entries := upcomingEntries(community, username, owners[username], upcoming, booked)
+
+		// Accounts that are only read to check bookings are recorded by the community they now belong to
+		if _, ok := checked[username]; !ok {
+			if err = sms.saveUpcoming(ctx, community, username, entries); err != nil {
+				continue
+			}
+		}
+		listed[username] = entries
+	}
+
+	for _, r := range removedReservations(booked, listed) {
+		util.LogInfo(sms.logger, "Reservation "+r.Id.Hex()+" is no longer listed on Avalon")
+		if !sms.markRemoved(ctx, r) {
+			continue
+		}
+
+		text := sms.message(r.CreatedBy, messages.ReservationRemoved, messages.Data{Activity: r.Activity, Date: r.Datetime.In(community.Loc).Format(util.ReservationDateTimeLayout)})
+		if err := sms.sendSMS(text, r.CreatedBy); err != nil {
+			util.LogSMSError(sms.logger, err, r.CreatedBy, text)
+		}
+	}
+}
+
+// Flags a booked reservation as removed. Returns false if it could not be flagged or was moved or cancelled while
+// Avalon was being read, in which case it is left as it now is.
+func (sms *SMSHandler) markRemoved(ctx context.Context, r *model.Reservation) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := sms.db.UpdateOne(ctx, bson.M{
+		"_id":       r.Id,
+		"status":    model.ReservationBooked,
+		"date_time": r.Datetime,
+	}, bson.M{"$set": bson.M{"status": model.ReservationRemoved}})
+	if err != nil {
+		util.LogDebug(sms.logger, "unable to flag reservation as removed: "+r.Id.Hex())
+		util.LogError(sms.logger, err)
+		return false
+	}
+
+	if result.ModifiedCount != 1 {
+		util.LogInfo(sms.logger, "Reservation "+r.Id.Hex()+" changed while syncing and is left as it is")
+		return false
+	}
+
+	r.Status = model.ReservationRemoved
+	return true
+}
+
+// Returns the upcoming reservations Avalon listed for the account as entries to record, each belonging to owner
+// unless the bot booked it for someone
+func upcomingEntries(community *model.AvalonDetails, username string, owner string, upcoming []model.Reservation, booked []model.Reservation) []model.UpcomingReservation {
+	now := time.Now().UTC()
+	var entries []model.UpcomingReservation
+	for _, r := range upcoming {
+		entry := model.UpcomingReservation{
+			Community: community.Key,
+			Account:   username,
+			User:      owner,
+			Activity:  r.Activity,
+			Datetime:  r.Datetime,
+			Duration:  r.Duration,
+			SyncedAt:  now,
+		}
+
+		// Bookings under the community account belong to whoever the bot made them for
+		if match := matchBooked(booked, &entry); match != nil {
+			entry.User = match.CreatedBy
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Returns the booked reservations that are no longer listed under the account they were made with. A booking can only
+// be known to be gone once its own account has been read, so reservations whose account could not be read, or that
+// were booked before accounts were recorded, are never returned.
+func removedReservations(booked []model.Reservation, listed map[string][]model.UpcomingReservation) []*model.Reservation {
+	var removed []*model.Reservation
+	for i := range booked {
+		upcoming, ok := listed[booked[i].Account]
+		if !ok || booked[i].Account == "" {
+			continue
+		}
+		if !matchUpcoming(upcoming, &booked[i]) {
+			removed = append(removed, &booked[i])
+		}
+	}
+	return removed
+}
+
+// Returns the users of the community who have linked their own Avalon account
+func (sms *SMSHandler) linkedUsers(ctx context.Context, community *model.AvalonDetails) ([]model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.users.Find(ctx, bson.M{"community": community.Key, "avalon": bson.M{"$exists": true}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving linked users of "+community.Key)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	var users []model.User
+	if err = cursor.All(ctx, &users); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Users")
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Returns the booked reservations of the community that have not started yet
+func (sms *SMSHandler) bookedReservations(ctx context.Context, community *model.AvalonDetails) ([]model.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.db.Find(ctx, bson.M{
+		"community": community.Key,
+		"status":    model.ReservationBooked,
+		"date_time": bson.M{"$gt": time.Now().UTC()},
+	})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving booked reservations of "+community.Key)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	var reservations []model.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Reservations")
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// Replaces the recorded upcoming reservations of the account with the ones just listed
+func (sms *SMSHandler) saveUpcoming(ctx context.Context, community *model.AvalonDetails, username string, entries []model.UpcomingReservation) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := sms.upcoming.DeleteMany(ctx, bson.M{"community": community.Key, "account": username})
+	if err != nil {
+		util.LogDebug(sms.logger, "Unable to clear upcoming reservations of "+username)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(entries))
+	for i := range entries {
+		documents[i] = entries[i]
+	}
+
+	_, err = sms.upcoming.InsertMany(ctx, documents)
+	if err != nil {
+		util.LogDebug(sms.logger, "Unable to save upcoming reservations of "+username)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	return nil
+}
+
+// Returns the upcoming reservations of the user that the bot did not make, i.e. booked on the Avalon website
+func (sms *SMSHandler) bookedElsewhere(ctx context.Context, userPhoneNumber string, reservations []model.Reservation) ([]model.UpcomingReservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.upcoming.Find(ctx, bson.M{"user": userPhoneNumber, "date_time": bson.M{"$gt": time.Now().UTC()}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving upcoming reservations for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	var upcoming []model.UpcomingReservation
+	if err = cursor.All(ctx, &upcoming); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to UpcomingReservations")
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	var elsewhere []model.UpcomingReservation
+	for i := range upcoming {
+		if matchBooked(reservations, &upcoming[i]) == nil {
+			elsewhere = append(elsewhere, upcoming[i])
+		}
+	}
+
+	return elsewhere, nil
+}
+
+// Returns the reservation for the activity and date/time of the upcoming reservation, booked under its account, or nil
+// if there is none
+func matchBooked(reservations []model.Reservation, entry *model.UpcomingReservation) *model.Reservation {
+	for i := range reservations {
+		if sameBooking(&reservations[i], entry) {
+			return &reservations[i]
+		}
+	}
+	return nil
+}
+
+// Returns true if the reservation is among the upcoming reservations
+func matchUpcoming(upcoming []model.UpcomingReservation, r *model.Reservation) bool {
+	for i := range upcoming {
+		if sameBooking(r, &upcoming[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the upcoming reservation is the booking of the reservation. Reservations booked before accounts were
+// recorded match under any account.
+func sameBooking(r *model.Reservation, entry *model.UpcomingReservation) bool {
+	return r.Activity == entry.Activity && r.Datetime.Equal(entry.Datetime) && (r.Account == "" || r.Account == entry.Account)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stevetu717/racquetball-bot/model"
+)
+
+func TestMatchBooked(t *testing.T) {
+	at := time.Date(2021, 3, 4, 19, 0, 0, 0, time.UTC)
+	booked := []model.Reservation{
+		{Activity: "racquetball", Datetime: at, CreatedBy: "+15555550100", Account: "community"},
+		{Activity: "tennis1", Datetime: at, CreatedBy: "+15555550101"},
+	}
+	tests := []struct {
+		name  string
+		entry model.UpcomingReservation
+		want  string
+	}{
+		{"Same account", model.UpcomingReservation{Activity: "racquetball", Datetime: at, Account: "community"}, "+15555550100"},
+		{"Other account", model.UpcomingReservation{Activity: "racquetball", Datetime: at, Account: "resident"}, ""},
+		{"Other time", model.UpcomingReservation{Activity: "racquetball", Datetime: at.Add(time.Hour), Account: "community"}, ""},
+		{"Booked before accounts were recorded", model.UpcomingReservation{Activity: "tennis1", Datetime: at, Account: "resident"}, "+15555550101"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchBooked(booked, &tt.entry)
+			if (got == nil && tt.want != "") || (got != nil && got.CreatedBy != tt.want) {
+				t.Errorf("matchBooked() = %+v, want the reservation of %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchUpcoming(t *testing.T) {
+	at := time.Date(2021, 3, 4, 19, 0, 0, 0, time.UTC)
+	upcoming := []model.UpcomingReservation{{Activity: "racquetball", Datetime: at, Account: "community"}}
+	tests := []struct {
+		name        string
+		reservation model.Reservation
+		want        bool
+	}{
+		{"Same account", model.Reservation{Activity: "racquetball", Datetime: at, Account: "community"}, true},
+		{"Other account", model.Reservation{Activity: "racquetball", Datetime: at, Account: "resident"}, false},
+		{"Other activity", model.Reservation{Activity: "tennis1", Datetime: at, Account: "community"}, false},
+		{"Booked before accounts were recorded", model.Reservation{Activity: "racquetball", Datetime: at}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchUpcoming(upcoming, &tt.reservation); got != tt.want {
+				t.Errorf("matchUpcoming() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemovedReservations(t *testing.T) {
+	at := time.Date(2021, 3, 4, 19, 0, 0, 0, time.UTC)
+	listed := map[string][]model.UpcomingReservation{
+		"community": {{Activity: "racquetball", Datetime: at, Account: "community"}},
+		"resident":  {{Activity: "tennis1", Datetime: at.Add(time.Hour), Account: "resident"}},
+	}
+	tests := []struct {
+		name        string
+		reservation model.Reservation
+		removed     bool
+	}{
+		{"Still listed", model.Reservation{Activity: "racquetball", Datetime: at, Account: "community"}, false},
+		{"No longer listed", model.Reservation{Activity: "tennis1", Datetime: at, Account: "resident"}, true},
+		{"Listed under another account only", model.Reservation{Activity: "racquetball", Datetime: at, Account: "resident"}, true},
+		{"Account could not be read", model.Reservation{Activity: "basketball", Datetime: at, Account: "unlinked"}, false},
+		{"Booked before accounts were recorded", model.Reservation{Activity: "basketball", Datetime: at}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := removedReservations([]model.Reservation{tt.reservation}, listed)
+			if got := len(removed) == 1; got != tt.removed {
+				t.Errorf("removedReservations() = %+v, want removed = %v", removed, tt.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
+	"github.com/stevetu717/racquetball-bot/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+func (sms *SMSHandler) handleNameSMS(body string, userPhoneNumber string) error {
+	name := strings.TrimSpace(strings.TrimSpace(body)[len(util.Name):])
+	if name == "" {
+		text := sms.message(userPhoneNumber, messages.InvalidName, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := sms.users.UpdateOne(ctx, bson.M{"_id": userPhoneNumber}, bson.M{"$set": bson.M{"name": name}}, options.Update().SetUpsert(true))
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving name for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	body = sms.message(userPhoneNumber, messages.NameSaved, messages.Data{Name: name})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Returns the name the user's reservations are made under, or "" if they have not set one
+func (sms *SMSHandler) displayName(userPhoneNumber string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := model.User{}
+	err := sms.users.FindOne(ctx, bson.M{"_id": userPhoneNumber}).Decode(&user)
+	if err != nil {
+		return ""
+	}
+
+	return user.Name
+}
+
+// Returns the user registered to the phone number, or nil if the number has never requested access
+func (sms *SMSHandler) getUser(userPhoneNumber string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := model.User{}
+	err := sms.users.FindOne(ctx, bson.M{"_id": userPhoneNumber}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while looking up user "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Replies to messages from numbers that are not approved and returns whether the message may be handled.
+// Unknown numbers may only request access.
+func (sms *SMSHandler) authorize(body string, rawBody string, userPhoneNumber string) (bool, error) {
+	user, err := sms.getUser(userPhoneNumber)
+	if err != nil {
+		return false, err
+	}
+
+	if user != nil && user.IsApproved() {
+		return true, nil
+	}
+
+	if user == nil && strings.HasPrefix(strings.TrimSpace(body), util.RequestAccess) {
+		return false, sms.handleRequestAccessSMS(rawBody, userPhoneNumber)
+	}
+
+	key := messages.NotRegistered
+	if user != nil && user.Status == model.UserPending {
+		key = messages.AccessPending
+	} else if user != nil && user.Status == model.UserDenied {
+		key = messages.AccessDenied
+	}
+	message := sms.message(userPhoneNumber, key, messages.Data{})
+
+	util.LogInfo(sms.logger, "Rejected message from unapproved number "+userPhoneNumber)
+	err = sms.sendSMS(message, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, message)
+		return false, err
+	}
+
+	return false, nil
+}
+
+func (sms *SMSHandler) handleRequestAccessSMS(body string, userPhoneNumber string) error {
+	name := strings.TrimSpace(strings.TrimSpace(body)[len(util.RequestAccess):])
+	if name == "" {
+		name = userPhoneNumber
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := &model.User{Phone: userPhoneNumber, Name: name, Role: model.RoleMember, Status: model.UserPending, RequestedAt: time.Now().UTC()}
+	_, err := sms.users.InsertOne(ctx, user)
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving access request for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	body = sms.message(userPhoneNumber, messages.AccessRequested, messages.Data{Name: name})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	sms.notifyAdmins(messages.AccessRequestAdmin, messages.Data{Name: name, Phone: userPhoneNumber})
+
+	return nil
+}
+
+// Approves or denies the access request of the phone number in the message. Only admins may do so.
+func (sms *SMSHandler) handleApprovalSMS(body string, userPhoneNumber string, status string) error {
+	admin, err := sms.getUser(userPhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if admin == nil || !admin.IsAdmin() {
+		util.LogInfo(sms.logger, "Rejected approval from non-admin "+userPhoneNumber)
+		return sms.sendCommandHelp(userPhoneNumber)
+	}
+
+	phoneNumber, err := util.GetPhoneNumber(body)
+	if err != nil {
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.InvalidApproval, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := model.User{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = sms.users.FindOneAndUpdate(ctx, bson.M{"_id": phoneNumber}, bson.M{"$set": bson.M{"status": status}}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		body := sms.message(userPhoneNumber, messages.UserNotFound, messages.Data{Phone: phoneNumber})
+		smsErr := sms.sendSMS(body, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, body)
+			return smsErr
+		}
+		return nil
+	} else if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while updating status of user "+phoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	util.LogInfo(sms.logger, "User "+phoneNumber+" is now "+status+" by "+userPhoneNumber)
+
+	confirmation, notice := messages.UserApproved, messages.AccessApproved
+	if status == model.UserDenied {
+		confirmation, notice = messages.UserDenied, messages.AccessDenied
+	}
+
+	text := sms.message(phoneNumber, notice, messages.Data{})
+	err = sms.sendSMS(text, phoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, phoneNumber, text)
+	}
+
+	body = sms.message(userPhoneNumber, confirmation, messages.Data{Name: user.Name, Phone: phoneNumber})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+// Texts every approved admin the message in their language
+func (sms *SMSHandler) notifyAdmins(key string, data messages.Data) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := sms.users.Find(ctx, bson.M{"role": model.RoleAdmin, "status": model.UserApproved})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while retrieving admins")
+		util.LogError(sms.logger, err)
+		return
+	}
+
+	var admins []model.User
+	if err = cursor.All(ctx, &admins); err != nil {
+		util.LogDebug(sms.logger, "Unable to serialize documents to Users")
+		util.LogError(sms.logger, err)
+		return
+	}
+
+	if len(admins) == 0 {
+		util.LogError(sms.logger, errors.New("no admins to notify: "+sms.messages.Render(messages.DefaultLanguage, key, data)))
+	}
+
+	for _, admin := range admins {
+		message := sms.messages.Render(admin.Language, key, data)
+		err = sms.sendSMS(message, admin.Phone)
+		if err != nil {
+			util.LogSMSError(sms.logger, err, admin.Phone, message)
+		}
+	}
+}
+
+// Returns true if the number belongs to an approved user
+func (sms *SMSHandler) isApproved(userPhoneNumber string) bool {
+	user, err := sms.getUser(userPhoneNumber)
+	return err == nil && user != nil && user.IsApproved()
+}
+
+func (sms *SMSHandler) handleLinkSMS(body string, userPhoneNumber string) error {
+	username, password, err := util.GetCredentials(body)
+	if err != nil {
+		text := sms.message(userPhoneNumber, messages.InvalidLink, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	account := &model.AvalonAccount{Username: username, Password: password}
+	err = sms.avalonClient(sms.userCommunity(userPhoneNumber).Key).LinkAccount(account)
+	if err != nil {
+		util.LogDebug(sms.logger, "Unable to link Avalon account for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		text := sms.message(userPhoneNumber, messages.LinkFailed, messages.Data{})
+		smsErr := sms.sendSMS(text, userPhoneNumber)
+		if smsErr != nil {
+			util.LogSMSError(sms.logger, smsErr, userPhoneNumber, text)
+			return smsErr
+		}
+		return nil
+	}
+
+	account.Password, err = util.Encrypt(account.Password, sms.config.Crypto.Key)
+	if err != nil {
+		util.LogDebug(sms.logger, "Unable to encrypt Avalon password for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = sms.users.UpdateOne(ctx, bson.M{"_id": userPhoneNumber}, bson.M{"$set": bson.M{"avalon": account}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while saving Avalon account for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	body = sms.message(userPhoneNumber, messages.AccountLinked, messages.Data{Username: account.Username})
+	err = sms.sendSMS(body, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, body)
+		return err
+	}
+
+	return nil
+}
+
+func (sms *SMSHandler) handleUnlinkSMS(userPhoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := sms.users.UpdateOne(ctx, bson.M{"_id": userPhoneNumber}, bson.M{"$unset": bson.M{"avalon": ""}})
+	if err != nil {
+		util.LogDebug(sms.logger, "An error occurred while removing Avalon account for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return err
+	}
+
+	text := sms.message(userPhoneNumber, messages.AccountUnlinked, messages.Data{})
+	err = sms.sendSMS(text, userPhoneNumber)
+	if err != nil {
+		util.LogSMSError(sms.logger, err, userPhoneNumber, text)
+		return err
+	}
+
+	return nil
+}
+
+// Returns the Avalon account a booked reservation was made under, or an error if it is no longer available because
+// the user has since unlinked it or linked another. Reservations booked before accounts were recorded fall back to the
+// user's current account.
+func (sms *SMSHandler) bookingAccount(r *model.Reservation, community *model.AvalonDetails) (*model.AvalonAccount, error) {
+	if r.Account == "" {
+		return sms.avalonAccount(r.CreatedBy, community)
+	}
+
+	if r.Account == community.Username {
+		return community.Account(), nil
+	}
+
+	user, err := sms.getUser(r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.Avalon == nil || user.Avalon.Username != r.Account {
+		return nil, errors.New("Avalon account " + r.Account + " of reservation " + r.Id.Hex() + " is no longer linked")
+	}
+
+	return sms.avalonAccount(r.CreatedBy, community)
+}
+
+// Returns the Avalon account reservations of the user are made under, falling back to the account of the community if
+// they have not linked their own
+func (sms *SMSHandler) avalonAccount(userPhoneNumber string, community *model.AvalonDetails) (*model.AvalonAccount, error) {
+	user, err := sms.getUser(userPhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.Avalon == nil {
+		return community.Account(), nil
+	}
+
+	account := *user.Avalon
+	account.Password, err = util.Decrypt(account.Password, sms.config.Crypto.Key)
+	if err != nil {
+		util.LogDebug(sms.logger, "Unable to decrypt Avalon password for "+userPhoneNumber)
+		util.LogError(sms.logger, err)
+		return nil, err
+	}
+
+	return &account, nil
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Activities recognizes the activities of a community and their aliases in messages
+type Activities struct {
+	regex *regexp.Regexp
+	// keywords maps every activity name and alias to the activities it stands for
+	keywords map[string][]string
+	names    []string
+}
+
+// Builds the matcher from the aliases of each activity. An alias shared by several activities stands for all of them,
+// in alphabetical order. An activity's own name always stands for only that activity.
+func NewActivities(aliases map[string][]string) *Activities {
+	keywords := make(map[string][]string)
+	var names []string
+
+	for activity, activityAliases := range aliases {
+		activity = strings.ToLower(activity)
+		names = append(names, activity)
+		for _, alias := range activityAliases {
+			alias = strings.ToLower(strings.TrimSpace(alias))
+			if alias != "" && !containsString(keywords[alias], activity) {
+				keywords[alias] = append(keywords[alias], activity)
+			}
+		}
+	}
+
+	for _, name := range names {
+		keywords[name] = []string{name}
+	}
+
+	var patterns []string
+	for keyword, activities := range keywords {
+		sort.Strings(activities)
+		patterns = append(patterns, keyword)
+	}
+	sort.Strings(names)
+
+	// Longer keywords first so that "tennis1" is not matched as "tennis"
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for i := range patterns {
+		patterns[i] = regexp.QuoteMeta(patterns[i])
+	}
+
+	regex := regexp.MustCompile(`(?i)\b(?:` + strings.Join(patterns, "|") + `)\b`)
+	if len(patterns) == 0 {
+		regex = regexp.MustCompile(`$^`)
+	}
+
+	return &Activities{regex: regex, keywords: keywords, names: names}
+}
+
+// Returns the activities the first activity name or alias in the message stands for
+func (a *Activities) Find(body string) ([]string, error) {
+	keyword := a.regex.FindString(body)
+
+	if keyword == "" {
+		return nil, errors.New("no valid activity provided")
+	}
+
+	return a.keywords[strings.ToLower(keyword)], nil
+}
+
+// Returns true if the message mentions an activity name or alias
+func (a *Activities) Contains(body string) bool {
+	return a.regex.MatchString(body)
+}
+
+// Describes the activities and their aliases for the help text,
+// i.e. "basketball (bball), tennis1, tennis2, or tennis for whichever of tennis1/tennis2 is free"
+func (a *Activities) Describe() string {
+	var descriptions []string
+	for _, name := range a.names {
+		var aliases []string
+		for keyword, activities := range a.keywords {
+			if keyword != name && len(activities) == 1 && activities[0] == name {
+				aliases = append(aliases, keyword)
+			}
+		}
+		sort.Strings(aliases)
+
+		if len(aliases) > 0 {
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", name, strings.Join(aliases, ", ")))
+		} else {
+			descriptions = append(descriptions, name)
+		}
+	}
+
+	var shared []string
+	for keyword, activities := range a.keywords {
+		if len(activities) > 1 {
+			shared = append(shared, fmt.Sprintf("%s for whichever of %s is free", keyword, strings.Join(activities, "/")))
+		}
+	}
+	sort.Strings(shared)
+
+	description := strings.Join(descriptions, ", ")
+	if len(shared) > 0 {
+		description += ", or " + strings.Join(shared, ", ")
+	}
+	return description
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestActivities(t *testing.T) {
+	activities := NewActivities(map[string][]string{
+		"racquetball": {"rb"},
+		"basketball":  {"bball", "Hoops"},
+		"tennis1":     {"tennis"},
+		"tennis2":     {"tennis"},
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{"Activity name", "racquetball tomorrow 7pm", []string{"racquetball"}, false},
+		{"Alias", "rb tomorrow 7pm", []string{"racquetball"}, false},
+		{"Alias in any case", "HOOPS fri 6pm", []string{"basketball"}, false},
+		{"Name is preferred over shorter alias", "tennis2 3/4 7pm", []string{"tennis2"}, false},
+		{"Shared alias", "tennis 3/4 7pm", []string{"tennis1", "tennis2"}, false},
+		{"Alias inside a word", "curbside 3/4 7pm", nil, true},
+		{"No activity", "tomorrow 7pm", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := activities.Find(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Find() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	want := "basketball (bball, hoops), racquetball (rb), tennis1, tennis2, or tennis for whichever of tennis1/tennis2 is free"
+	if got := activities.Describe(); got != want {
+		t.Errorf("Describe() = %v, want %v", got, want)
+	}
+}
@@ -1,30 +1,87 @@
 package util
 
 const (
-	Schedule         = "schedule"
-	ReservationSaved = "Your reservation has been saved. We will attempt to secure it the day before the reservation. Thank you!"
-	ReservationError = "Failed to save the reservation. Contact the dev with Rsvp ID: "
+	Schedule       = "schedule"
+	Cancel         = "cancel"
+	List           = "list"
+	MyReservations = "my reservations"
+	Move           = "move"
+	Avail          = "avail"
+	Name           = "name"
+	Language       = "language"
+	// Idioma lets Spanish speakers find the language command
+	Idioma         = "idioma"
+	RequestAccess  = "request access"
+	Link           = "link"
+	Unlink         = "unlink"
+	Approve        = "approve"
+	Deny           = "deny"
+	Yes            = "yes"
+	No             = "no"
+	Every          = "every"
+	Rules          = "rules"
+	StopRule       = "stop rule"
+	Assist         = "assist"
+	Help           = "help"
+	Admin          = "admin"
+	AdminPending   = "pending"
+	AdminCancel    = "cancel"
+	AdminPause     = "pause"
+	AdminResume    = "resume"
+	AdminLogin     = "login"
+	AdminCommunity = "community"
+)
 
-	// SMS
-	SmsHelp   = "To use this system please message in the format: <activity> mm/dd/yy hh:mm <am/pm>. Example: tennis1 2/12/21 8:00pm. " +
-		"Valid activities: racquetball, basketball, tennis1, tennis2. Only 1 reservation per activity per day will work."
-	SmsInvalidDateTime = "Please enter a date and time in the correct format. Text 'assist' for help."
-	SmsInvalidDateTimeRange = "Amenities are only open between 8AM and 8PM EST. Please try again with a valid time."
-	SmsInvalidActivity = "Please enter a valid activity you would like to schedule. Text 'assist' for help."
-	SmsSuccessfulReservation = "Your reservation has been successfully made for %s on %s."
-	SmsFailedReservation = "We were unable to make your reservation for %s on %s. It may have been taken or the website has changed."
+// Carrier-standard keywords, matched against the whole message. Twilio blocks messages to numbers that text any of the
+// stop keywords, so a bare "cancel" has to be honoured as an opt-out even though it is also the start of a command.
+var (
+	StopKeywords  = []string{"stop", "stopall", "unsubscribe", "cancel", "end", "quit"}
+	StartKeywords = []string{"start", "unstop"}
+	HelpKeywords  = []string{"help", "info"}
 )
 
 const (
-	dateTimeRegexRaw          = `(?i)(0?[1-9]|1[012])[-\/.](0?[1-9]|[12][0-9]|3[01])[-\/.]2[0-9]\s((0[1-9]:[0-5][0-9]((AM)|(PM)))|([1-9]:[0-5][0-9]((AM)|(PM)))|(1[0-2]:[0-5][0-9]((AM)|(PM))))`
-	activityRegexRaw          = `(?i)racquetball|basketball|tennis1|tennis2`
+	dateRegexRaw              = `(?i)\b(?:(today|tonight|tomorrow|tmrw|tmr)|(sun(?:day)?|mon(?:day)?|tue(?:s|sday)?|wed(?:nesday)?|thu(?:r|rs|rsday)?|fri(?:day)?|sat(?:urday)?)|(0?[1-9]|1[012])[-\/](0?[1-9]|[12][0-9]|3[01])(?:[-\/](\d{4}|\d{2}))?)\b`
+	timeRegexRaw              = `(?i)\b(?:(1[0-2]|0?[1-9])(?::([0-5][0-9]))?\s?([ap])\.?m?\.?|([01]?[0-9]|2[0-3]):([0-5][0-9]))(?:\b|$)`
+	reservationIdRegexRaw     = `(?i)\b[0-9a-f]{24}\b`
+	shortReplyRegexRaw        = `(?i)^\s*(yes|y|no|n|\d{1,2})\s*$`
+	durationRegexRaw          = `(?i)\b(\d+(?:\.\d+)?)\s?(h|hr|hrs|hours?|m|mins?|minutes?)\b`
+	phoneNumberRegexRaw       = `\+?\d[\d\-\s().]{8,}\d`
+	notesRegexRaw             = `(?is)\bnotes?:\s*(.*)$`
+	guestsRegexRaw            = `(?i)\bwith\s+(.+)$`
+	guestSeparatorRegexRaw    = `(?i)\s*(?:,|&|\band\b)\s*`
+	partySizeRegexRaw         = `(?i)\b(?:party\s+of\s+(\d+)|(\d+)\s+(?:people|players|persons))\b`
+	orRegexRaw                = `(?i)\bor\s+`
+	everyRegexRaw             = `(?i)\bevery\s+`
+	moveToRegexRaw            = `(?i)\s+to\s+`
+	untilRegexRaw             = `(?i)\buntil\s+`
+	upcomingDateRegexRaw      = `[A-Z][a-z]+ \d{1,2}, \d{4}`
+	upcomingTimeRegexRaw      = `\d{1,2}:\d{2} [AP]M`
+	ClosedHours               = "closed"
+	HoursDateLayout           = `Mon 1/2`
+	RuleTimeLayout            = `3:04pm`
+	SummaryDateTimeLayout     = `Mon Jan 2 3:04`
+	RuleEndDateLayout         = `1/2/06`
 	ReservationDateTimeLayout = `1/2/06 3:04pm`
-	AvalonBaseUrl             = "https://www.avalonaccess.com"
-	AvalonLoginUrl            = AvalonBaseUrl + "/UserProfile/LogOn"
-	AvalonAmenityUrl          = AvalonBaseUrl + "/Information/Information/AmenityReservation?amenityKey="
-	AvalonAmenitiesUrl        = AvalonBaseUrl + "/Information/Information/Amenities"
-	AvalonSaveReservationUrl  = AvalonBaseUrl + "/Information/Information/SaveAmenityReservation"
-	VerificationTokenXpath    = "//form//input[@name=\"__RequestVerificationToken\"]"
-	UpcomingReservationsXpath = "//*[@id=\"upcomingReservation\"]/div/div"
+	UpcomingDateLayout        = `January 02, 2006`
+	UpcomingTimeLayout        = `3:04 PM`
+	AvalonNotesMaxLength      = 200
+	// AvalonBaseUrl is the Avalon website, used by communities that do not configure another base URL
+	AvalonBaseUrl     = "https://www.avalonaccess.com"
+	AvalonLoginPath   = "/UserProfile/LogOn"
+	AvalonAmenityPath = "/Information/Information/AmenityReservation?amenityKey="
+	// AvalonAmenityDateParam picks the day the amenity reservation page offers start times for, formatted as 1/2/2006
+	AvalonAmenityDateParam        = "&reservationDate="
+	AvalonAmenitiesPath           = "/Information/Information/Amenities"
+	AvalonSaveReservationPath     = "/Information/Information/SaveAmenityReservation"
+	AvalonCancelReservationPath   = "/Information/Information/CancelAmenityReservation"
+	VerificationTokenXpath        = "//form//input[@name=\"__RequestVerificationToken\"]"
+	UpcomingReservationsXpath     = "//*[@id=\"upcomingReservation\"]/div/div"
+	UpcomingReservationsListXpath = "//*[@id=\"upcomingReservation\"]"
+	CancelVerificationTokenXpath  = ".//form//input[@name=\"__RequestVerificationToken\"]"
+	LeaseIdXpath                  = "//form//input[@name=\"LeaseId\"]"
+	PersonIdXpath                 = "//form//input[@name=\"PersonId\"]"
+	StartTimeSelectXpath          = "//form//select[@name=\"SelStartTime\"]"
+	StartTimeOptionsXpath         = "//form//select[@name=\"SelStartTime\"]/option"
+	CancelReservationIdXpath      = ".//form//input[@name=\"Id\"]"
 )
-
@@ -0,0 +1,31 @@
+package util
+
+import "testing"
+
+func TestEncryptDecrypt(t *testing.T) {
+	encrypted, err := Encrypt("hunter2", "secret key")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	if encrypted == "hunter2" {
+		t.Errorf("Encrypt() returned the plaintext")
+	}
+
+	decrypted, err := Decrypt(encrypted, "secret key")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+
+	if decrypted != "hunter2" {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, "hunter2")
+	}
+
+	if _, err = Decrypt(encrypted, "wrong key"); err == nil {
+		t.Errorf("Decrypt() with the wrong key succeeded")
+	}
+
+	if _, err = Encrypt("hunter2", ""); err == nil {
+		t.Errorf("Encrypt() without a key succeeded")
+	}
+}
@@ -0,0 +1,374 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var DateRegex = regexp.MustCompile(dateRegexRaw)
+var TimeRegex = regexp.MustCompile(timeRegexRaw)
+var DurationRegex = regexp.MustCompile(durationRegexRaw)
+var OrRegex = regexp.MustCompile(orRegexRaw)
+var EveryRegex = regexp.MustCompile(everyRegexRaw)
+var MoveToRegex = regexp.MustCompile(moveToRegexRaw)
+var UntilRegex = regexp.MustCompile(untilRegexRaw)
+var UpcomingDateRegex = regexp.MustCompile(upcomingDateRegexRaw)
+var UpcomingTimeRegex = regexp.MustCompile(upcomingTimeRegexRaw)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func GetDateTimeUTC(input string, loc *time.Location) (time.Time, error) {
+	dateTime, err := ParseDateTime(input, time.Now(), loc)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return dateTime.In(time.UTC), nil
+}
+
+// Returns the length of a booking such as "2h", "90m" or "1.5 hours", or zero if the message does not contain one
+func GetDuration(body string) (time.Duration, error) {
+	match := DurationRegex.FindStringSubmatch(body)
+
+	if match == nil {
+		return 0, nil
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, errors.New("Unable to parse duration: " + match[0])
+	}
+
+	unit := time.Minute
+	if strings.HasPrefix(strings.ToLower(match[2]), "h") {
+		unit = time.Hour
+	}
+
+	return time.Duration(amount * float64(unit)), nil
+}
+
+// Formats a duration the way users write it, i.e. "2h", "30m" or "1h30m"
+func FormatDuration(duration time.Duration) string {
+	hours := duration / time.Hour
+	minutes := (duration % time.Hour) / time.Minute
+
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+
+	return fmt.Sprintf("%dh%dm", hours, minutes)
+}
+
+// Returns true if the local time of day is a whole multiple of granularity from midnight
+func AlignedTo(dateTime time.Time, granularity time.Duration, loc *time.Location) bool {
+	local := dateTime.In(loc)
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+
+	return local.Nanosecond() == 0 && sinceMidnight%granularity == 0
+}
+
+// Returns the fallback times listed after "or" on the same local date as dateTime, in the order given
+func GetAlternativesUTC(input string, dateTime time.Time, loc *time.Location) ([]time.Time, error) {
+	date := dateTime.In(loc)
+	var alternatives []time.Time
+
+	for _, or := range OrRegex.FindAllStringIndex(input, -1) {
+		rest := input[or[1]:]
+		if match := TimeRegex.FindStringIndex(rest); match == nil || match[0] != 0 {
+			return nil, errors.New("no valid time provided after 'or': " + input)
+		}
+
+		hour, minute, err := parseClock(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		alternatives = append(alternatives, time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc).In(time.UTC))
+	}
+
+	return alternatives, nil
+}
+
+// Parses the first date and time found in the input, resolved in loc relative to now.
+// Dates may be relative (today, tomorrow), a weekday name or mm/dd with an optional year and default to today.
+// Times may be 12-hour with optional minutes (7pm, 7:30 pm) or 24-hour (18:00).
+func ParseDateTime(input string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+
+	dateMatch := DateRegex.FindStringSubmatchIndex(input)
+	rest := input
+	if dateMatch != nil {
+		rest = input[:dateMatch[0]] + " " + input[dateMatch[1]:]
+	}
+
+	hour, minute, err := parseClock(rest)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return resolveDate(submatches(input, dateMatch), now, hour, minute, loc)
+}
+
+// Parses the first date found in the input to its midnight in loc, defaulting to today.
+// Unlike ParseDateTime a weekday resolves to today when today is that weekday.
+func ParseDate(input string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+	// Resolving to the last minute of the day keeps today's weekday from moving to next week
+	date, err := resolveDate(submatches(input, DateRegex.FindStringSubmatchIndex(input)), now, 23, 59, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc), nil
+}
+
+// Returns the weekday, hour and minute of a weekly reservation i.e. "every tue 7:00pm"
+func GetWeeklyTime(body string) (time.Weekday, int, int, error) {
+	every := EveryRegex.FindStringIndex(body)
+	if every == nil {
+		return 0, 0, 0, errors.New("no valid weekday/time provided")
+	}
+
+	rest := body[every[1]:]
+	match := DateRegex.FindStringSubmatchIndex(rest)
+	if match == nil || match[0] != 0 || match[4] < 0 {
+		return 0, 0, 0, errors.New("no valid weekday provided: " + body)
+	}
+
+	hour, minute, err := parseClock(rest[match[1]:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return weekdays[strings.ToLower(rest[match[4]:match[4]+3])], hour, minute, nil
+}
+
+// Returns the end of the day given after "until", or nil if the message does not contain one
+func GetEndDate(body string, loc *time.Location) (*time.Time, error) {
+	until := UntilRegex.FindStringIndex(body)
+	if until == nil {
+		return nil, nil
+	}
+
+	rest := body[until[1]:]
+	match := DateRegex.FindStringSubmatchIndex(rest)
+	if match == nil || match[0] != 0 {
+		return nil, errors.New("Unable to parse end date: " + body)
+	}
+
+	date, err := resolveDate(submatches(rest, match), time.Now().In(loc), 0, 0, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	endDate := date.AddDate(0, 0, 1).Add(-time.Second).In(time.UTC)
+	return &endDate, nil
+}
+
+// Parses the date, start and end time of an upcoming reservation listed by Avalon i.e. "March 04, 2021 7:00 PM - 8:00 PM"
+// and returns the start in UTC with the length of the reservation
+func ParseUpcomingDetails(details string, loc *time.Location) (time.Time, time.Duration, error) {
+	date := UpcomingDateRegex.FindString(details)
+	times := UpcomingTimeRegex.FindAllString(details, 2)
+	if date == "" || len(times) != 2 {
+		return time.Time{}, 0, errors.New("Unable to parse upcoming reservation: " + details)
+	}
+
+	start, err := time.ParseInLocation(UpcomingDateLayout+" "+UpcomingTimeLayout, date+" "+times[0], loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	end, err := time.ParseInLocation(UpcomingDateLayout+" "+UpcomingTimeLayout, date+" "+times[1], loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start.In(time.UTC), end.Sub(start), nil
+}
+
+// Parses an option of the start time select on an amenity reservation page, i.e. "Thursday-7:00 PM-8:00 PM", into its
+// start on the date in loc and its length
+func ParseStartTimeOption(value string, date time.Time, loc *time.Location) (time.Time, time.Duration, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 3 {
+		return time.Time{}, 0, errors.New("Unable to parse start time option: " + value)
+	}
+
+	day := date.In(loc).Format("1/2/2006")
+	start, err := time.ParseInLocation("1/2/2006 "+UpcomingTimeLayout, day+" "+strings.TrimSpace(parts[1]), loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	end, err := time.ParseInLocation("1/2/2006 "+UpcomingTimeLayout, day+" "+strings.TrimSpace(parts[2]), loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start.In(time.UTC), end.Sub(start), nil
+}
+
+// Parses opening hours such as "8:00am-8:00pm" into the time after midnight the amenity opens and closes.
+// "closed" parses to zero for both. A close at or before the open, i.e. "12am", is the end of the day.
+func ParseOpeningHours(hours string) (time.Duration, time.Duration, error) {
+	hours = strings.ToLower(strings.TrimSpace(hours))
+	if hours == ClosedHours {
+		return 0, 0, nil
+	}
+
+	parts := strings.SplitN(hours, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("Unable to parse opening hours: " + hours)
+	}
+
+	openHour, openMinute, err := parseClock(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	closeHour, closeMinute, err := parseClock(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	open := time.Duration(openHour)*time.Hour + time.Duration(openMinute)*time.Minute
+	close := time.Duration(closeHour)*time.Hour + time.Duration(closeMinute)*time.Minute
+	if close <= open {
+		close += 24 * time.Hour
+	}
+
+	return open, close, nil
+}
+
+// Returns true if a booking from start for length falls within the opening hours of its day in loc.
+// Empty hours are open around the clock.
+func WithinOpeningHours(hours string, start time.Time, length time.Duration, loc *time.Location) (bool, error) {
+	if strings.TrimSpace(hours) == "" {
+		return true, nil
+	}
+
+	open, close, err := ParseOpeningHours(hours)
+	if err != nil {
+		return false, err
+	}
+
+	local := start.In(loc)
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	return sinceMidnight >= open && sinceMidnight+length <= close, nil
+}
+
+func submatches(input string, match []int) []string {
+	if match == nil {
+		return nil
+	}
+
+	groups := make([]string, len(match)/2)
+	for i := range groups {
+		if match[2*i] >= 0 {
+			groups[i] = input[match[2*i]:match[2*i+1]]
+		}
+	}
+
+	return groups
+}
+
+// Returns the hour and minute of the first time found in the input
+func parseClock(input string) (int, int, error) {
+	match := TimeRegex.FindStringSubmatch(input)
+
+	if match == nil {
+		return 0, 0, errors.New("no valid time provided: " + input)
+	}
+
+	if match[3] == "" {
+		hour, _ := strconv.Atoi(match[4])
+		minute, _ := strconv.Atoi(match[5])
+		return hour, minute, nil
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	hour = hour % 12
+	if strings.ToLower(match[3]) == "p" {
+		hour += 12
+	}
+
+	return hour, minute, nil
+}
+
+// Resolves the groups of a DateRegex match to a date at hour:minute in loc.
+// Weekdays and dates without a year resolve to their next occurrence from now.
+func resolveDate(match []string, now time.Time, hour int, minute int, loc *time.Location) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	at := func(date time.Time) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc)
+	}
+
+	switch {
+	case match == nil:
+		return at(today), nil
+	case match[1] != "":
+		if relative := strings.ToLower(match[1]); relative == "today" || relative == "tonight" {
+			return at(today), nil
+		}
+		return at(today.AddDate(0, 0, 1)), nil
+	case match[2] != "":
+		weekday := weekdays[strings.ToLower(match[2][:3])]
+		dateTime := at(today.AddDate(0, 0, (int(weekday)-int(today.Weekday())+7)%7))
+		if !dateTime.After(now) {
+			dateTime = dateTime.AddDate(0, 0, 7)
+		}
+		return dateTime, nil
+	}
+
+	month, _ := strconv.Atoi(match[3])
+	day, _ := strconv.Atoi(match[4])
+	year := today.Year()
+	if match[5] != "" {
+		year, _ = strconv.Atoi(match[5])
+		if year < 100 {
+			year += 2000
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, errors.New("invalid date: " + match[0])
+	}
+
+	if match[5] == "" && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+
+	return at(date), nil
+}
@@ -0,0 +1,310 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateTime(t *testing.T) {
+	// Tuesday, March 2 2021 at 10:00 AM
+	now := time.Date(2021, 3, 2, 10, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"Full date with year", "tennis1 2/12/21 8:00pm", time.Date(2021, 2, 12, 20, 0, 0, 0, DefaultLoc), false},
+		{"Four digit year", "tennis1 3/12/2021 8:00pm", time.Date(2021, 3, 12, 20, 0, 0, 0, DefaultLoc), false},
+		{"Uppercase meridiem", "tennis1 3/12/21 8:00PM", time.Date(2021, 3, 12, 20, 0, 0, 0, DefaultLoc), false},
+		{"Space before meridiem", "racquetball 3/4 7:00 pm", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), false},
+		{"Date without year in the past", "racquetball 1/4 7:00pm", time.Date(2022, 1, 4, 19, 0, 0, 0, DefaultLoc), false},
+		{"Date without year today", "racquetball 3/2 7pm", time.Date(2021, 3, 2, 19, 0, 0, 0, DefaultLoc), false},
+		{"Hour without minutes", "tennis1 tomorrow 7pm", time.Date(2021, 3, 3, 19, 0, 0, 0, DefaultLoc), false},
+		{"Minutes are kept", "tennis1 tomorrow 7:30pm", time.Date(2021, 3, 3, 19, 30, 0, 0, DefaultLoc), false},
+		{"Abbreviated tomorrow", "tennis2 tmrw 6 pm", time.Date(2021, 3, 3, 18, 0, 0, 0, DefaultLoc), false},
+		{"Today", "basketball today 5pm", time.Date(2021, 3, 2, 17, 0, 0, 0, DefaultLoc), false},
+		{"Tonight", "basketball tonight 8:00 p.m.", time.Date(2021, 3, 2, 20, 0, 0, 0, DefaultLoc), false},
+		{"No date defaults to today", "basketball 5pm", time.Date(2021, 3, 2, 17, 0, 0, 0, DefaultLoc), false},
+		{"Weekday with 24-hour time", "basketball fri 18:00", time.Date(2021, 3, 5, 18, 0, 0, 0, DefaultLoc), false},
+		{"Full weekday name", "basketball Friday 6pm", time.Date(2021, 3, 5, 18, 0, 0, 0, DefaultLoc), false},
+		{"Weekday later today", "basketball tue 6pm", time.Date(2021, 3, 2, 18, 0, 0, 0, DefaultLoc), false},
+		{"Weekday earlier today", "basketball tuesday 9am", time.Date(2021, 3, 9, 9, 0, 0, 0, DefaultLoc), false},
+		{"Weekday at the end of the week", "basketball sun 12pm", time.Date(2021, 3, 7, 12, 0, 0, 0, DefaultLoc), false},
+		{"Noon", "racquetball 3/4/21 12:00pm", time.Date(2021, 3, 4, 12, 0, 0, 0, DefaultLoc), false},
+		{"Midnight", "racquetball 3/4/21 12am", time.Date(2021, 3, 4, 0, 0, 0, 0, DefaultLoc), false},
+		{"Time before date", "racquetball 7pm 3/4", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), false},
+		{"Activity digit is not a time", "tennis1 3/4 7pm", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), false},
+		{"Duration is not a time", "tennis1 3/4/21 6:00pm 2h", time.Date(2021, 3, 4, 18, 0, 0, 0, DefaultLoc), false},
+		{"Decimal duration is not a date", "tennis1 7pm 1.5 hours", time.Date(2021, 3, 2, 19, 0, 0, 0, DefaultLoc), false},
+		{"Dashed date", "tennis1 3-4 7pm", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), false},
+		{"Missing time", "racquetball 3/4/21", time.Time{}, true},
+		{"Bare hour is not a time", "racquetball 3/4/21 7", time.Time{}, true},
+		{"Invalid date", "racquetball 2/30/21 7pm", time.Time{}, true},
+		{"Invalid 24-hour time", "racquetball 3/4/21 25:00", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDateTime(tt.input, now, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDateTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseDateTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDateTimeUTC(t *testing.T) {
+	got, err := GetDateTimeUTC("racquetball tomorrow 7:30pm", DefaultLoc)
+	if err != nil {
+		t.Fatalf("GetDateTimeUTC() error = %v", err)
+	}
+
+	tomorrow := time.Now().In(DefaultLoc).AddDate(0, 0, 1)
+	want := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 19, 30, 0, 0, DefaultLoc)
+	if !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("GetDateTimeUTC() = %v, want %v in UTC", got, want)
+	}
+}
+
+func TestGetWeeklyTime(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantWeekday time.Weekday
+		wantHour    int
+		wantMinute  int
+		wantErr     bool
+	}{
+		{"Short weekday", "racquetball every tue 7:00pm", time.Tuesday, 19, 0, false},
+		{"Full weekday with space", "tennis1 every Saturday 10:30 am", time.Saturday, 10, 30, false},
+		{"Hour without minutes", "tennis1 every thurs 7pm until 5/1/21", time.Thursday, 19, 0, false},
+		{"24-hour time", "basketball every sun 18:00", time.Sunday, 18, 0, false},
+		{"Missing time", "basketball every fri", 0, 0, 0, true},
+		{"Missing weekday", "basketball every 7:00pm", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weekday, hour, minute, err := GetWeeklyTime(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetWeeklyTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if weekday != tt.wantWeekday || hour != tt.wantHour || minute != tt.wantMinute {
+				t.Errorf("GetWeeklyTime() = %v %d:%d, want %v %d:%d", weekday, hour, minute, tt.wantWeekday, tt.wantHour, tt.wantMinute)
+			}
+		})
+	}
+}
+
+func TestGetAlternativesUTC(t *testing.T) {
+	dateTime := time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name    string
+		input   string
+		want    []time.Time
+		wantErr bool
+	}{
+		{"No alternatives", "racquetball 3/4/21 7:00pm", nil, false},
+		{
+			"Alternatives in order",
+			"racquetball 3/4/21 7:00pm or 8:00pm or 6pm",
+			[]time.Time{time.Date(2021, 3, 4, 20, 0, 0, 0, DefaultLoc), time.Date(2021, 3, 4, 18, 0, 0, 0, DefaultLoc)},
+			false,
+		},
+		{"Alternative without a time", "racquetball 3/4/21 7:00pm or later", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetAlternativesUTC(tt.input, dateTime, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetAlternativesUTC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetAlternativesUTC() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("GetAlternativesUTC()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Duration
+	}{
+		{"No duration", "tennis1 3/4/21 6:00pm", 0},
+		{"Hours", "tennis1 3/4/21 6:00pm 2h", 2 * time.Hour},
+		{"Fractional hours", "tennis1 3/4/21 6:00pm 1.5 hours", 90 * time.Minute},
+		{"Minutes", "racquetball tomorrow 7pm 30min", 30 * time.Minute},
+		{"Meridiem is not minutes", "racquetball tomorrow 7 pm", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetDuration(tt.input)
+			if err != nil {
+				t.Fatalf("GetDuration() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignedTo(t *testing.T) {
+	tests := []struct {
+		name        string
+		dateTime    time.Time
+		granularity time.Duration
+		want        bool
+	}{
+		{"On the hour", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), time.Hour, true},
+		{"Half hour on hourly slots", time.Date(2021, 3, 4, 19, 30, 0, 0, DefaultLoc), time.Hour, false},
+		{"Half hour on half hourly slots", time.Date(2021, 3, 4, 19, 30, 0, 0, DefaultLoc), 30 * time.Minute, true},
+		{"Odd hour on two hour slots", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), 2 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AlignedTo(tt.dateTime, tt.granularity, DefaultLoc); got != tt.want {
+				t.Errorf("AlignedTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUpcomingDetails(t *testing.T) {
+	tests := []struct {
+		name         string
+		details      string
+		wantStart    time.Time
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{"One hour", "March 04, 2021 7:00 PM - 8:00 PM", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), time.Hour, false},
+		{"Surrounding text", "\n  Thursday, March 04, 2021 from 10:30 AM to 12:30 PM ", time.Date(2021, 3, 4, 10, 30, 0, 0, DefaultLoc), 2 * time.Hour, false},
+		{"Ends at midnight", "March 04, 2021 11:00 PM - 12:00 AM", time.Date(2021, 3, 4, 23, 0, 0, 0, DefaultLoc), time.Hour, false},
+		{"Missing end time", "March 04, 2021 7:00 PM", time.Time{}, 0, true},
+		{"Missing date", "7:00 PM - 8:00 PM", time.Time{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotDuration, err := ParseUpcomingDetails(tt.details, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUpcomingDetails() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotStart.Equal(tt.wantStart) {
+				t.Errorf("ParseUpcomingDetails() start = %v, want %v", gotStart, tt.wantStart)
+			}
+			if gotDuration != tt.wantDuration {
+				t.Errorf("ParseUpcomingDetails() duration = %v, want %v", gotDuration, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestWithinOpeningHours(t *testing.T) {
+	evening := time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name    string
+		hours   string
+		start   time.Time
+		length  time.Duration
+		want    bool
+		wantErr bool
+	}{
+		{"No hours", "", time.Date(2021, 3, 4, 3, 0, 0, 0, DefaultLoc), time.Hour, true, false},
+		{"Within hours", "8:00am-8:00pm", evening, time.Hour, true, false},
+		{"Ends after close", "8:00am-8:00pm", evening, 2 * time.Hour, false, false},
+		{"Before open", "8am-8pm", time.Date(2021, 3, 4, 7, 0, 0, 0, DefaultLoc), time.Hour, false, false},
+		{"At open", "8am-8pm", time.Date(2021, 3, 4, 8, 0, 0, 0, DefaultLoc), time.Hour, true, false},
+		{"Closes at midnight", "6:00pm-12:00am", time.Date(2021, 3, 4, 23, 0, 0, 0, DefaultLoc), time.Hour, true, false},
+		{"24-hour times", "08:00-20:00", evening, time.Hour, true, false},
+		{"Closed", "closed", evening, time.Hour, false, false},
+		{"Evaluated in local time", "8am-8pm", time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), time.Hour, true, false},
+		{"Invalid hours", "8am", evening, time.Hour, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WithinOpeningHours(tt.hours, tt.start, tt.length, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WithinOpeningHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WithinOpeningHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	// Tuesday, March 2 2021 at 10:00 AM
+	now := time.Date(2021, 3, 2, 10, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"No date defaults to today", "avail rb", time.Date(2021, 3, 2, 0, 0, 0, 0, DefaultLoc), false},
+		{"Tomorrow", "avail rb tomorrow", time.Date(2021, 3, 3, 0, 0, 0, 0, DefaultLoc), false},
+		{"Today's weekday", "avail rb tue", time.Date(2021, 3, 2, 0, 0, 0, 0, DefaultLoc), false},
+		{"Next weekday", "avail rb fri", time.Date(2021, 3, 5, 0, 0, 0, 0, DefaultLoc), false},
+		{"Full date", "avail tennis1 3/4/21", time.Date(2021, 3, 4, 0, 0, 0, 0, DefaultLoc), false},
+		{"Invalid date", "avail rb 2/30/21", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDate(tt.input, now, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStartTimeOption(t *testing.T) {
+	date := time.Date(2021, 3, 4, 0, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name         string
+		value        string
+		wantStart    time.Time
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{"One hour", "Thursday-7:00 PM-8:00 PM", time.Date(2021, 3, 4, 19, 0, 0, 0, DefaultLoc), time.Hour, false},
+		{"Half hour", "Thursday-10:30 AM-11:00 AM", time.Date(2021, 3, 4, 10, 30, 0, 0, DefaultLoc), 30 * time.Minute, false},
+		{"Ends at midnight", "Thursday-11:00 PM-12:00 AM", time.Date(2021, 3, 4, 23, 0, 0, 0, DefaultLoc), time.Hour, false},
+		{"Placeholder", "", time.Time{}, 0, true},
+		{"Invalid time", "Thursday-7 PM-8 PM", time.Time{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotDuration, err := ParseStartTimeOption(tt.value, date, DefaultLoc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStartTimeOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotStart.Equal(tt.wantStart) {
+				t.Errorf("ParseStartTimeOption() start = %v, want %v", gotStart, tt.wantStart)
+			}
+			if gotDuration != tt.wantDuration {
+				t.Errorf("ParseStartTimeOption() duration = %v, want %v", gotDuration, tt.wantDuration)
+			}
+		})
+	}
+}
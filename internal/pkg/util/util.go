@@ -3,14 +3,23 @@ package util
 import (
 	"errors"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
-var Loc, _ = time.LoadLocation("America/New_York")
-var DateTimeRegex = regexp.MustCompile(dateTimeRegexRaw)
-var ActivityRegex = regexp.MustCompile(activityRegexRaw)
+// DefaultLoc is the timezone of communities that do not configure one
+var DefaultLoc, _ = time.LoadLocation("America/New_York")
+var ReservationIdRegex = regexp.MustCompile(reservationIdRegexRaw)
+var ShortReplyRegex = regexp.MustCompile(shortReplyRegexRaw)
+var PhoneNumberRegex = regexp.MustCompile(phoneNumberRegexRaw)
+var NotesRegex = regexp.MustCompile(notesRegexRaw)
+var GuestsRegex = regexp.MustCompile(guestsRegexRaw)
+var GuestSeparatorRegex = regexp.MustCompile(guestSeparatorRegexRaw)
+var PartySizeRegex = regexp.MustCompile(partySizeRegexRaw)
 
 func ContainsIgnoreCase(string string, substring string) bool {
 	return strings.Contains(strings.ToLower(string), substring)
@@ -42,42 +51,152 @@ func LogSMSError(log *logrus.Logger, error interface{}, userPhoneNumber string,
 	}).Error(error)
 }
 
-func GetDateTimeUTC(input string) (time.Time, error) {
-	dateTimeString := DateTimeRegex.FindString(input)
+// Logs why a reservation could not be made, with the step of talking to Avalon that failed and the reason it failed
+func LogReservationError(log *logrus.Logger, error interface{}, reservationId string, step string, reason string) {
+	log.WithFields(logrus.Fields{
+		"app":         "racquetball-bot",
+		"reservation": reservationId,
+		"step":        step,
+		"reason":      reason,
+	}).Error(error)
+}
 
-	if dateTimeString == "" {
-		return time.Time{}, errors.New("no valid date/time provided")
+func GetReservationId(body string) (primitive.ObjectID, error) {
+	id := ReservationIdRegex.FindString(body)
+
+	if id == "" {
+		return primitive.NilObjectID, errors.New("no valid reservation id provided")
 	}
 
-	dateTime, err := time.ParseInLocation(ReservationDateTimeLayout, dateTimeString, Loc)
+	return primitive.ObjectIDFromHex(strings.ToLower(id))
+}
+
+// Returns the first phone number in the message in E.164 format, assuming US numbers when no country code is given
+func GetPhoneNumber(body string) (string, error) {
+	match := PhoneNumberRegex.FindString(body)
 
+	if match == "" {
+		return "", errors.New("no valid phone number provided")
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, match)
+
+	if strings.HasPrefix(match, "+") {
+		return "+" + digits, nil
+	} else if len(digits) == 10 {
+		return "+1" + digits, nil
+	} else if len(digits) == 11 && strings.HasPrefix(digits, "1") {
+		return "+" + digits, nil
+	}
+
+	return "", errors.New("Unable to parse phone number: " + match)
+}
+
+// Returns the Avalon username and password of a link command, i.e. "link resident my secret". The password is
+// everything after the username, so it may contain spaces.
+func GetCredentials(body string) (string, string, error) {
+	fields := strings.TrimSpace(body)
+	if !strings.HasPrefix(strings.ToLower(fields), Link+" ") {
+		return "", "", errors.New("not a link command")
+	}
+
+	fields = strings.TrimSpace(fields[len(Link):])
+	end := strings.IndexFunc(fields, unicode.IsSpace)
+	if end < 0 {
+		return "", "", errors.New("no password provided for " + fields)
+	}
+
+	return fields[:end], strings.TrimSpace(fields[end:]), nil
+}
+
+// Returns the message as it may be logged, with the password of a link command left out
+func RedactCredentials(body string) string {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(body)), Link+" ") {
+		return body
+	}
+
+	username, _, err := GetCredentials(body)
 	if err != nil {
-		return time.Time{}, errors.New("Unable to parse datetime: " + input)
+		return Link + " [redacted]"
 	}
 
-	dateTime = dateTime.In(time.UTC)
-	dateTime = time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), dateTime.Hour(), 0, 0, 0, time.UTC)
+	return Link + " " + username + " [redacted]"
+}
 
-	return dateTime, err
+// Returns the note given after "note:" at the end of the message, and the message without it
+func GetNotes(body string) (string, string) {
+	match := NotesRegex.FindStringSubmatchIndex(body)
+
+	if match == nil {
+		return "", body
+	}
+
+	return strings.TrimSpace(body[match[2]:match[3]]), body[:match[0]]
+}
+
+// Returns the guest names listed after "with", and the message without them. The list ends at the first date, time,
+// duration, party size or alternative after it, so "with Alex 3/4 7pm" leaves the date and time in the message.
+func GetGuests(body string) ([]string, string) {
+	match := GuestsRegex.FindStringSubmatchIndex(body)
+
+	if match == nil {
+		return nil, body
+	}
+
+	list, rest := body[match[2]:match[3]], ""
+	for _, regex := range []*regexp.Regexp{DateRegex, TimeRegex, DurationRegex, PartySizeRegex, OrRegex} {
+		if end := regex.FindStringIndex(list); end != nil {
+			list, rest = list[:end[0]], list[end[0]:]+rest
+		}
+	}
+
+	var guests []string
+	for _, guest := range GuestSeparatorRegex.Split(list, -1) {
+		if guest = strings.TrimSpace(guest); guest != "" {
+			guests = append(guests, guest)
+		}
+	}
+
+	return guests, body[:match[0]] + rest
+}
+
+// Returns the party size given as "party of 4" or "4 people", or zero if the message does not contain one
+func GetPartySize(body string) int {
+	match := PartySizeRegex.FindStringSubmatch(body)
+
+	if match == nil {
+		return 0
+	}
+
+	size, _ := strconv.Atoi(match[1] + match[2])
+	return size
 }
 
-func GetActivity(body string) (string, error) {
-	activity := ActivityRegex.FindString(body)
+// Returns the first occurrence of weekday at hour:minute in loc strictly after the given time
+func NextOccurrence(after time.Time, weekday time.Weekday, hour int, minute int, loc *time.Location) time.Time {
+	after = after.In(loc)
+	next := time.Date(after.Year(), after.Month(), after.Day(), hour, minute, 0, 0, loc)
+	next = next.AddDate(0, 0, (int(weekday)-int(next.Weekday())+7)%7)
 
-	if activity == "" {
-		return "", errors.New("no valid activity provided")
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 7)
 	}
 
-	return activity, nil
+	return next.In(time.UTC)
 }
 
-// Returns the duration until reservations become schedulable
-// i.e. the day before the datetime but with 30 seconds extra to prepare payload
-func DurationUntilSchedulable(datetime time.Time) time.Duration {
-	datetime = datetime.In(Loc)
-	datetime = datetime.AddDate(0, 0, -2)
-	datetime = time.Date(datetime.Year(), datetime.Month(), datetime.Day(), 23, 59, 30, 0, Loc)
-	d := datetime.Sub(time.Now().In(Loc))
+// Returns the duration until reservations become schedulable, i.e. just before midnight when the datetime enters the
+// booking window of windowDays days, with 30 seconds extra to prepare payload
+func DurationUntilSchedulable(datetime time.Time, loc *time.Location, windowDays int) time.Duration {
+	datetime = datetime.In(loc)
+	datetime = datetime.AddDate(0, 0, -windowDays)
+	datetime = time.Date(datetime.Year(), datetime.Month(), datetime.Day(), 23, 59, 30, 0, loc)
+	d := datetime.Sub(time.Now().In(loc))
 	return d
 }
 
@@ -87,8 +206,16 @@ func DurationFromNowInLoc(datetime time.Time, Loc *time.Location) time.Duration
 	return d
 }
 
-func DateTimeWithinTwoDays(dateTime time.Time) bool {
-	endDate := time.Now().In(Loc).Add(time.Hour * 48)
-	endDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, Loc)
-	return dateTime.In(Loc).Before(endDate)
-}
\ No newline at end of file
+// Returns true if the datetime can already be booked, i.e. it is before midnight windowDays days from now
+func DateTimeWithinBookingWindow(dateTime time.Time, loc *time.Location, windowDays int) bool {
+	endDate := time.Now().In(loc).AddDate(0, 0, windowDays)
+	endDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, loc)
+	return dateTime.In(loc).Before(endDate)
+}
+
+// Returns the start of the local day of the date/time and the start of the following day, both in UTC
+func DayBoundsUTC(dateTime time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := dateTime.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return start.In(time.UTC), start.AddDate(0, 0, 1).In(time.UTC)
+}
@@ -1,11 +1,12 @@
 package util
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
 
-func TestDateTimeWithinTwoDays(t *testing.T) {
+func TestDateTimeWithinBookingWindow(t *testing.T) {
 	type args struct {
 		dateTime time.Time
 	}
@@ -35,9 +36,168 @@ func TestDateTimeWithinTwoDays(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := DateTimeWithinTwoDays(tt.args.dateTime); got != tt.want {
-				t.Errorf("DateTimeWithinTwoDays() = %v, want %v", got, tt.want)
+			if got := DateTimeWithinBookingWindow(tt.args.dateTime, time.Local, 2); got != tt.want {
+				t.Errorf("DateTimeWithinBookingWindow() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestNextOccurrence(t *testing.T) {
+	type args struct {
+		after   time.Time
+		weekday time.Weekday
+		hour    int
+		minute  int
+	}
+	// Tuesday, March 2 2021
+	tuesday := time.Date(2021, 3, 2, 18, 0, 0, 0, DefaultLoc)
+	tests := []struct {
+		name string
+		args args
+		want time.Time
+	}{
+		{
+			"Later the same day",
+			args{after: tuesday, weekday: time.Tuesday, hour: 19, minute: 0},
+			time.Date(2021, 3, 2, 19, 0, 0, 0, DefaultLoc),
+		},
+		{
+			"Earlier the same day",
+			args{after: tuesday, weekday: time.Tuesday, hour: 17, minute: 30},
+			time.Date(2021, 3, 9, 17, 30, 0, 0, DefaultLoc),
+		},
+		{
+			"Exactly the given time",
+			args{after: tuesday, weekday: time.Tuesday, hour: 18, minute: 0},
+			time.Date(2021, 3, 9, 18, 0, 0, 0, DefaultLoc),
+		},
+		{
+			"Later in the week",
+			args{after: tuesday, weekday: time.Friday, hour: 8, minute: 0},
+			time.Date(2021, 3, 5, 8, 0, 0, 0, DefaultLoc),
+		},
+		{
+			"Across daylight saving time",
+			args{after: time.Date(2021, 3, 7, 19, 0, 0, 0, DefaultLoc), weekday: time.Sunday, hour: 19, minute: 0},
+			time.Date(2021, 3, 14, 19, 0, 0, 0, DefaultLoc),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextOccurrence(tt.args.after, tt.args.weekday, tt.args.hour, tt.args.minute, DefaultLoc); !got.Equal(tt.want) {
+				t.Errorf("NextOccurrence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetGuests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantGuests []string
+		wantRest   string
+	}{
+		{"No guests", "racquetball 3/4/21 7:00pm", nil, "racquetball 3/4/21 7:00pm"},
+		{"Comma separated", "racquetball 3/4/21 7:00pm with Alex, Sam", []string{"Alex", "Sam"}, "racquetball 3/4/21 7:00pm "},
+		{"And separated", "Tennis1 tomorrow 6pm WITH Alex and Sam Lee", []string{"Alex", "Sam Lee"}, "Tennis1 tomorrow 6pm "},
+		{"Before the date and time", "racquetball with Alex 3/4 7pm", []string{"Alex"}, "racquetball 3/4 7pm"},
+		{"Before the time", "racquetball tomorrow with Alex, Sam 7:30pm 2h", []string{"Alex", "Sam"}, "racquetball tomorrow 7:30pm 2h"},
+		{"Before party size", "basketball fri 6pm with Sam party of 4", []string{"Sam"}, "basketball fri 6pm party of 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guests, rest := GetGuests(tt.body)
+			if !reflect.DeepEqual(guests, tt.wantGuests) || rest != tt.wantRest {
+				t.Errorf("GetGuests() = %q, %q, want %q, %q", guests, rest, tt.wantGuests, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestGetNotes(t *testing.T) {
+	notes, rest := GetNotes("racquetball 3/4/21 7:00pm with Alex note: League match, court 2")
+	if notes != "League match, court 2" || rest != "racquetball 3/4/21 7:00pm with Alex " {
+		t.Errorf("GetNotes() = %q, %q", notes, rest)
+	}
+
+	notes, rest = GetNotes("racquetball 3/4/21 7:00pm note: League match\ncourt 2")
+	if notes != "League match\ncourt 2" || rest != "racquetball 3/4/21 7:00pm " {
+		t.Errorf("GetNotes() = %q, %q", notes, rest)
+	}
+
+	notes, rest = GetNotes("racquetball 3/4/21 7:00pm")
+	if notes != "" || rest != "racquetball 3/4/21 7:00pm" {
+		t.Errorf("GetNotes() = %q, %q", notes, rest)
+	}
+}
+
+func TestGetPhoneNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"E.164", "approve +15551234567", "+15551234567", false},
+		{"Ten digits", "deny 555-123-4567", "+15551234567", false},
+		{"Eleven digits", "approve 1 (555) 123-4567", "+15551234567", false},
+		{"Missing", "approve steve", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetPhoneNumber(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPhoneNumber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetPhoneNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{"Username and password", "link resident secret", "resident", "secret", false},
+		{"Password keeps its case", "Link Resident S3cret!", "Resident", "S3cret!", false},
+		{"Password with spaces", "link resident correct horse battery", "resident", "correct horse battery", false},
+		{"Missing password", "link resident", "", "", true},
+		{"Not a link command", "unlink", "", "", true},
+		{"Word starting with link", "linked up", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, err := GetCredentials(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("GetCredentials() = %q, %q, want %q, %q", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestRedactCredentials(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"link resident correct horse battery", "link resident [redacted]"},
+		{"link resident", "link [redacted]"},
+		{"racquetball tomorrow 7pm", "racquetball tomorrow 7pm"},
+	}
+	for _, tt := range tests {
+		if got := RedactCredentials(tt.body); got != tt.want {
+			t.Errorf("RedactCredentials(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/sfreiberg/gotwilio"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"github.com/stevetu717/racquetball-bot/internal/pkg/messages"
 	"github.com/stevetu717/racquetball-bot/internal/pkg/services"
 	"github.com/stevetu717/racquetball-bot/internal/pkg/util"
 	"github.com/stevetu717/racquetball-bot/model"
@@ -17,6 +18,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"math/rand"
 	"net/http"
 	_ "net/http"
 	"time"
@@ -29,12 +31,18 @@ func main() {
 	logger := initLogger()
 	config := initConfig(*env)
 
+	// Seed the draws of the lottery conflict policy
+	rand.Seed(time.Now().UnixNano())
+
 	// Init Twilio
 	twilioService := gotwilio.NewTwilioClient(config.Twilio.TwilioAccountSid,
 		config.Twilio.TwilioAuthToken)
 
-	// Init AvalonService
-	avalonService := &services.AvalonService{Logger: logger, AvalonDetails: config.Avalon, HttpClient: &http.Client{}}
+	// Init an AvalonClient per community
+	avalonClients := make(map[string]services.AvalonClient)
+	for _, community := range config.Communities {
+		avalonClients[community.Key] = &services.AvalonService{Logger: logger, AvalonDetails: community}
+	}
 
 	// Init DB
 	dbURI := config.Mongo.URI
@@ -44,6 +52,10 @@ func main() {
 	}
 	database := dbClient.Database("reservations")
 	collection := database.Collection("reservations")
+	rules := database.Collection("rules")
+	users := database.Collection("users")
+	optOuts := database.Collection("opt_outs")
+	upcoming := database.Collection("upcoming")
 
 	// Validate DB
 	err = validateDB(rootContext, collection, logger)
@@ -51,11 +63,40 @@ func main() {
 		logger.Fatal("Unable to clean up database - ", err)
 	}
 
+	err = validateCommunities(rootContext, []*mongo.Collection{collection, rules, users}, config.Communities[0].Key, logger)
+	if err != nil {
+		logger.Fatal("Unable to migrate communities - ", err)
+	}
+
+	err = validateUsers(rootContext, users, logger)
+	if err != nil {
+		logger.Fatal("Unable to migrate users - ", err)
+	}
+
+	err = seedAdmins(rootContext, users, config.Admins, logger)
+	if err != nil {
+		logger.Fatal("Unable to seed admins - ", err)
+	}
+
+	// Load the built-in messages and their translations
+	catalog, err := messages.Load(config.Messages.Dir, config.Messages.Templates)
+	if err != nil {
+		logger.Fatal("Unable to load messages - ", err)
+	}
+
 	// Init SMSHandler
-	smsService := services.NewSMSHandler(logger, collection, twilioService, avalonService, config)
+	smsService := services.NewSMSHandler(logger, collection, rules, users, optOuts, upcoming, twilioService, avalonClients, config, catalog)
 
 	// Load All Jobs
-	loadJobs(rootContext, collection, logger, avalonService, smsService)
+	loadJobs(rootContext, collection, logger, smsService)
+
+	// Expand weekly rules into reservations as their booking windows open
+	smsService.StartRuleExpansion(rootContext, time.Hour)
+
+	// Read back upcoming reservations from Avalon to catch bookings made or cancelled outside the bot
+	if config.Sync.Interval > 0 {
+		smsService.StartSync(rootContext, config.Sync.Interval)
+	}
 
 	// Init WebServer
 	serveMux := http.NewServeMux()
@@ -64,11 +105,11 @@ func main() {
 	http.ListenAndServe(":8080", serveMux)
 }
 
-func loadJobs(ctx context.Context, collection *mongo.Collection, logger *logrus.Logger, avalonService *services.AvalonService, smsService *services.SMSHandler) {
+func loadJobs(ctx context.Context, collection *mongo.Collection, logger *logrus.Logger, smsService *services.SMSHandler) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.D{})
+	cursor, err := collection.Find(ctx, bson.M{"status": model.ReservationPending})
 	if err != nil {
 		logger.Fatal("Exception occurred while retrieving jobs - ", err)
 	}
@@ -82,7 +123,7 @@ func loadJobs(ctx context.Context, collection *mongo.Collection, logger *logrus.
 			logger.Fatal("Unable to serialize document to Reservation - ", err)
 		}
 
-		smsService.ScheduleJob(&reservation, collection, avalonService)
+		smsService.ScheduleJob(&reservation, collection)
 		util.LogInfo(logger, "Added Reservation: "+reservation.Id.Hex()+" to scheduler...")
 	}
 
@@ -95,10 +136,12 @@ func validateDB(ctx context.Context, collection *mongo.Collection, logger *logru
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	// Past bookings are kept as the history the rotation conflict policy counts
 	filter := bson.M{
 		"date_time": bson.M{
 			"$lte": curTime,
 		},
+		"status": bson.M{"$ne": model.ReservationBooked},
 	}
 
 	_, err := collection.DeleteMany(ctx, filter)
@@ -108,6 +151,72 @@ func validateDB(ctx context.Context, collection *mongo.Collection, logger *logru
 		return err
 	}
 
+	// Reservations saved before statuses were tracked are all still waiting to be made
+	_, err = collection.UpdateMany(ctx, bson.M{"status": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"status": model.ReservationPending}})
+	if err != nil {
+		util.LogDebug(logger, "failed to migrate reservation statuses")
+		util.LogError(logger, err)
+		return err
+	}
+
+	return nil
+}
+
+func validateUsers(ctx context.Context, users *mongo.Collection, logger *logrus.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// Users who set a name before access was restricted were already using the bot
+	_, err := users.UpdateMany(ctx, bson.M{"status": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"status": model.UserApproved, "role": model.RoleMember}})
+	if err != nil {
+		util.LogDebug(logger, "failed to migrate user statuses")
+		util.LogError(logger, err)
+		return err
+	}
+
+	return nil
+}
+
+// Assigns documents saved before there were multiple communities to the first configured community
+func validateCommunities(ctx context.Context, collections []*mongo.Collection, community string, logger *logrus.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, collection := range collections {
+		_, err := collection.UpdateMany(ctx, bson.M{"community": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"community": community}})
+		if err != nil {
+			util.LogDebug(logger, "failed to migrate communities of "+collection.Name())
+			util.LogError(logger, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Approves the configured phone numbers as admins so that there is always someone to review access requests
+func seedAdmins(ctx context.Context, users *mongo.Collection, admins []string, logger *logrus.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, admin := range admins {
+		phoneNumber, err := util.GetPhoneNumber(admin)
+		if err != nil {
+			util.LogError(logger, err)
+			continue
+		}
+
+		_, err = users.UpdateOne(ctx, bson.M{"_id": phoneNumber}, bson.M{
+			"$set":         bson.M{"role": model.RoleAdmin, "status": model.UserApproved},
+			"$setOnInsert": bson.M{"name": phoneNumber, "requested_at": time.Now().UTC()},
+		}, options.Update().SetUpsert(true))
+		if err != nil {
+			util.LogDebug(logger, "failed to seed admin "+phoneNumber)
+			util.LogError(logger, err)
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -125,42 +234,86 @@ func initConfig(env string) *model.Config {
 		config = getAwsConfig(config)
 	}
 
+	if len(config.Communities) == 0 {
+		log.Fatal("No communities configured.")
+	}
+
+	for i := range config.Communities {
+		community := &config.Communities[i]
+		community.Loc = util.DefaultLoc
+		if community.Timezone != "" {
+			loc, err := time.LoadLocation(community.Timezone)
+			if err != nil {
+				log.Fatal("Invalid timezone for community "+community.Key+": ", err)
+			}
+			community.Loc = loc
+		}
+
+		for activity, amenity := range community.Amenities {
+			for _, hours := range append(mapValues(amenity.Hours), mapValues(amenity.Holidays)...) {
+				if _, _, err := util.ParseOpeningHours(hours); err != nil {
+					log.Fatal("Invalid hours for "+activity+" in community "+community.Key+": ", err)
+				}
+			}
+		}
+	}
+
 	return config
 }
 
+func mapValues(m map[string]string) []string {
+	var values []string
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
+
 func getAwsConfig(config *model.Config) *model.Config {
 	twilioSID, _ := getParam("/avalon-bot/prod/twilio-sid")
 	twilioToken, _ := getParam("/avalon-bot/prod/twilio-api-key")
 	twilioPhone, _ := getParam("/avalon-bot/prod/twilio-phone")
-	username, _ := getParam("/avalon-bot/prod/username")
-	password, _ := getParam("/avalon-bot/prod/password")
 	dbURI, _ := getParam("/avalon-bot/prod/db-uri")
-	leaseId, _ := getParam("/avalon-bot/prod/lease-id")
-	personId, _ := getParam("/avalon-bot/prod/person-id")
+	cryptoKey, _ := getParam("/avalon-bot/prod/crypto-key")
 
-	if len(twilioSID) == 0 || len(twilioToken) == 0 || len(twilioPhone) == 0 || len(username) == 0 || len(password) == 0 || len(dbURI) == 0 || len(leaseId) == 0 || len(personId) == 0{
+	if len(twilioSID) == 0 || len(twilioToken) == 0 || len(twilioPhone) == 0 || len(dbURI) == 0 || len(cryptoKey) == 0 {
 		log.Fatal("Unable to retrieve params from AWS parameter store.")
 	}
 
 	config.Twilio.TwilioAccountSid = twilioSID
 	config.Twilio.TwilioAuthToken = twilioToken
 	config.Twilio.PhoneNumber = twilioPhone
-	config.Avalon.Username = username
-	config.Avalon.Password = password
 	config.Mongo.URI = dbURI
-	config.Avalon.LeaseId = leaseId
-	config.Avalon.PersonId = personId
+	config.Crypto.Key = cryptoKey
+
+	for i := range config.Communities {
+		community := &config.Communities[i]
+		prefix := "/avalon-bot/prod/" + community.Key + "/"
+		username, _ := getParam(prefix + "username")
+		password, _ := getParam(prefix + "password")
+		leaseId, _ := getParam(prefix + "lease-id")
+		personId, _ := getParam(prefix + "person-id")
+
+		if len(username) == 0 || len(password) == 0 || len(leaseId) == 0 || len(personId) == 0 {
+			log.Fatal("Unable to retrieve params for community " + community.Key + " from AWS parameter store.")
+		}
+
+		community.Username = username
+		community.Password = password
+		community.LeaseId = leaseId
+		community.PersonId = personId
+	}
 
 	return config
 }
 
 func getParam(name string) (string, error) {
 	sess, err := session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{Region: aws.String("us-east-2b"), CredentialsChainVerboseErrors: aws.Bool(true)},
+		Config:            aws.Config{Region: aws.String("us-east-2b"), CredentialsChainVerboseErrors: aws.Bool(true)},
 		SharedConfigState: session.SharedConfigEnable,
 	})
 
-	if err != nil{
+	if err != nil {
 		log.Fatal("Unable to create AWS Session", err)
 	}
 
@@ -174,7 +327,7 @@ func getParam(name string) (string, error) {
 	)
 
 	if err != nil {
-		log.Fatal("Unable to get parameter " + name + " from AWS Session - ", err)
+		log.Fatal("Unable to get parameter "+name+" from AWS Session - ", err)
 	}
 
 	return aws.StringValue(output.Parameter.Value), nil
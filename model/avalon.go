@@ -1,17 +1,131 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
 
+// DefaultDuration is the length of a booking when neither the request nor the amenity specify one
+const DefaultDuration = time.Hour
+
+// DefaultBookingWindowDays is how many days ahead Avalon opens bookings when the community does not say otherwise
+const DefaultBookingWindowDays = 2
+
+// Policies deciding which of two users queueing the same slot keeps it
+const (
+	ConflictFirstCome = "first-come"
+	ConflictRotation  = "rotation"
+	ConflictLottery   = "lottery"
+)
+
+// AvalonDetails describes one community (building) on Avalon and the account the bot books it with
 type AvalonDetails struct {
-	Amenities map[string]Amenity `mapstructure:"amenities"`
-	LeaseId string
-	PersonId string
+	// Key identifies the community that users and reservations belong to
+	Key  string
+	Name string
+	// Timezone is the IANA name of the community's timezone, America/New_York when unset
+	Timezone string
+	// Loc is loaded from Timezone on startup
+	Loc *time.Location `mapstructure:"-"`
+	// BaseUrl is the address of the Avalon website, https://www.avalonaccess.com when unset. Local development can point
+	// it at a fake server.
+	BaseUrl string `mapstructure:"baseUrl"`
+	// BookingWindowDays is how many days ahead bookings open, DefaultBookingWindowDays when unset
+	BookingWindowDays int                `mapstructure:"bookingWindowDays"`
+	Amenities         map[string]Amenity `mapstructure:"amenities"`
+	// ConflictPolicy is one of ConflictFirstCome, ConflictRotation or ConflictLottery, first-come when unset
+	ConflictPolicy  string `mapstructure:"conflictPolicy"`
+	LeaseId         string
+	PersonId        string
 	ReservationName string
-	Username string
-	Password string
+	Username        string
+	Password        string
+}
+
+// BookingWindow returns how many days ahead bookings open in the community
+func (ad AvalonDetails) BookingWindow() int {
+	if ad.BookingWindowDays <= 0 {
+		return DefaultBookingWindowDays
+	}
+	return ad.BookingWindowDays
+}
+
+// Slot is a start time the amenity reservation page offers on Avalon
+type Slot struct {
+	Start    time.Time
+	Duration time.Duration
+	// Taken is true when the slot is listed but already booked
+	Taken bool
+}
+
+// AvalonAccount is the login and lease an Avalon reservation is made under
+type AvalonAccount struct {
+	Username string `bson:"username"`
+	// Password is encrypted while the account is stored
+	Password string `bson:"password"`
+	LeaseId  string `bson:"lease_id"`
+	PersonId string `bson:"person_id"`
+}
+
+// Account returns the account configured for the community, used for users who have not linked their own
+func (ad AvalonDetails) Account() *AvalonAccount {
+	return &AvalonAccount{Username: ad.Username, Password: ad.Password, LeaseId: ad.LeaseId, PersonId: ad.PersonId}
 }
 
-type Amenity struct{
-	Key string
+type Amenity struct {
+	Key  string
 	Name string
-	Id string
-}
\ No newline at end of file
+	Id   string
+	// Aliases are other words members can use for the amenity. An alias shared by several amenities books whichever
+	// of them is free.
+	Aliases []string
+	// Durations lists the booking lengths the amenity allows, the first being the default
+	Durations []time.Duration
+	// SlotGranularity is the interval from midnight that bookings must start on
+	SlotGranularity time.Duration
+	// MaxCapacity is the largest party the amenity can be booked for, unlimited when zero
+	MaxCapacity int
+	// Hours maps a weekday ("mon" to "sun") or "default" to the hours the amenity is open that day in the community's
+	// timezone, i.e. "8:00am-8:00pm" or "closed". The amenity is open around the clock when no hours are configured.
+	Hours map[string]string
+	// Holidays overrides Hours on dates given as "2006-01-02"
+	Holidays map[string]string
+}
+
+// HoursOn returns the opening hours of the amenity on the date of local, or "" if it is open around the clock
+func (a Amenity) HoursOn(local time.Time) string {
+	if hours, ok := a.Holidays[local.Format("2006-01-02")]; ok {
+		return hours
+	}
+
+	if hours, ok := a.Hours[strings.ToLower(local.Weekday().String()[:3])]; ok {
+		return hours
+	}
+
+	return a.Hours["default"]
+}
+
+// AllowedDurations returns the booking lengths of the amenity, one hour if none are configured
+func (a Amenity) AllowedDurations() []time.Duration {
+	if len(a.Durations) == 0 {
+		return []time.Duration{DefaultDuration}
+	}
+	return a.Durations
+}
+
+func (a Amenity) AllowsDuration(duration time.Duration) bool {
+	for _, allowed := range a.AllowedDurations() {
+		if allowed == duration {
+			return true
+		}
+	}
+	return false
+}
+
+// Granularity returns the slot granularity of the amenity, one hour if none is configured
+func (a Amenity) Granularity() time.Duration {
+	if a.SlotGranularity <= 0 {
+		return DefaultDuration
+	}
+	return a.SlotGranularity
+}
@@ -1,13 +1,50 @@
 package model
 
+import "time"
+
 type Twilio struct {
 	TwilioAccountSid string
 	TwilioAuthToken  string
-	PhoneNumber string
+	PhoneNumber      string
+}
+
+// Crypto holds the key that secrets stored in the database are encrypted with
+type Crypto struct {
+	Key string
+}
+
+// Messages translates and overrides the built-in English messages
+type Messages struct {
+	// Dir holds a <language>.yml file of message templates per language
+	Dir string
+	// Templates maps a language to message templates by key, taking precedence over the files in Dir
+	Templates map[string]map[string]string
+}
+
+// Sync sets how often the upcoming reservations of every account are read back from Avalon
+type Sync struct {
+	// Interval between syncs, syncing is off when zero
+	Interval time.Duration
 }
 
 type Config struct {
-	Twilio Twilio
-	Avalon AvalonDetails
-	Mongo  Mongo
+	Twilio      Twilio
+	Communities []AvalonDetails
+	Mongo       Mongo
+	Crypto      Crypto
+	Messages    Messages
+	Sync        Sync
+	// Admins are the phone numbers that are approved as admins on startup
+	Admins []string
+}
+
+// Community returns the community with the key, or the first community for users and reservations that predate
+// communities or whose community is no longer configured
+func (c *Config) Community(key string) *AvalonDetails {
+	for i := range c.Communities {
+		if c.Communities[i].Key == key {
+			return &c.Communities[i]
+		}
+	}
+	return &c.Communities[0]
 }
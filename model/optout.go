@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// OptOut is a phone number that replied STOP and must not be texted until it replies START
+type OptOut struct {
+	Phone      string    `bson:"_id"`
+	OptedOutAt time.Time `bson:"opted_out_at"`
+}
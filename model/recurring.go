@@ -0,0 +1,20 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RecurringRule is a weekly slot that is expanded into a Reservation as each booking window opens
+type RecurringRule struct {
+	Id            primitive.ObjectID `bson:"_id"`
+	Activity      string             `bson:"activity"`
+	Community     string             `bson:"community,omitempty"`
+	Weekday       time.Weekday       `bson:"weekday"`
+	Hour          int                `bson:"hour"`
+	Minute        int                `bson:"minute"`
+	Duration      time.Duration      `bson:"duration,omitempty"`
+	EndDate       *time.Time         `bson:"end_date,omitempty"`
+	CreatedBy     string             `bson:"created_by"`
+	LastScheduled time.Time          `bson:"last_scheduled"`
+}
@@ -5,9 +5,68 @@ import (
 	"time"
 )
 
+const (
+	ReservationPending = "pending"
+	ReservationBooked  = "booked"
+	ReservationFailed  = "failed"
+	// ReservationRemoved is a booking that Avalon no longer lists as upcoming, i.e. cancelled by the building staff
+	ReservationRemoved = "removed"
+)
+
 type Reservation struct {
-	Id primitive.ObjectID 			`bson:"_id"`
-	Datetime time.Time 				`bson:"date_time"`
-	Activity string 				`bson:"activity"`
-	CreatedBy string				`bson:"created_by"`
-}
\ No newline at end of file
+	Id           primitive.ObjectID `bson:"_id"`
+	Datetime     time.Time          `bson:"date_time"`
+	Alternatives []time.Time        `bson:"alternatives,omitempty"`
+	Activity     string             `bson:"activity"`
+	// Community is the key of the community the reservation is made in, the first configured community when empty
+	Community string        `bson:"community,omitempty"`
+	Duration  time.Duration `bson:"duration,omitempty"`
+	CreatedBy string        `bson:"created_by"`
+	// ReservationName is the display name of the user at the time of the request
+	ReservationName string   `bson:"reservation_name,omitempty"`
+	Guests          []string `bson:"guests,omitempty"`
+	PartySize       int      `bson:"party_size,omitempty"`
+	Notes           string   `bson:"notes,omitempty"`
+	Status          string   `bson:"status"`
+	// Account is the Avalon username the reservation was booked under, empty until it is booked
+	Account string              `bson:"account,omitempty"`
+	RuleId  *primitive.ObjectID `bson:"rule_id,omitempty"`
+	// Replaces is the date/time of a booking to release once this reservation has been moved and secured
+	Replaces *time.Time `bson:"replaces,omitempty"`
+}
+
+// Slots returns the date/time of the reservation followed by its fallback times in order of preference
+func (r *Reservation) Slots() []time.Time {
+	return append([]time.Time{r.Datetime}, r.Alternatives...)
+}
+
+// Length returns the duration of the reservation, which is an hour for reservations saved before durations were tracked
+func (r *Reservation) Length() time.Duration {
+	if r.Duration <= 0 {
+		return DefaultDuration
+	}
+	return r.Duration
+}
+
+// Party returns the number of people the reservation is for, at least the user and their guests
+func (r *Reservation) Party() int {
+	if r.PartySize > len(r.Guests) {
+		return r.PartySize
+	}
+	return len(r.Guests) + 1
+}
+
+// UpcomingReservation is a reservation Avalon listed as upcoming when the bookings were last synced
+type UpcomingReservation struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	Community string             `bson:"community"`
+	// Account is the Avalon username the reservation is listed under
+	Account string `bson:"account"`
+	// User is the phone number of the user the reservation belongs to, empty for bookings made on the website under
+	// the community account
+	User     string        `bson:"user,omitempty"`
+	Activity string        `bson:"activity"`
+	Datetime time.Time     `bson:"date_time"`
+	Duration time.Duration `bson:"duration"`
+	SyncedAt time.Time     `bson:"synced_at"`
+}
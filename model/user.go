@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	UserPending  = "pending"
+	UserApproved = "approved"
+	UserDenied   = "denied"
+
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+// User is someone who has texted the bot, keyed by their phone number
+type User struct {
+	Phone       string    `bson:"_id"`
+	Name        string    `bson:"name"`
+	Role        string    `bson:"role"`
+	Status      string    `bson:"status"`
+	RequestedAt time.Time `bson:"requested_at,omitempty"`
+	// Community is the key of the community the user books in, the first configured community when empty
+	Community string `bson:"community,omitempty"`
+	// Language is the code of the language messages are sent to the user in, English when empty
+	Language string `bson:"language,omitempty"`
+	// Avalon is the user's own Avalon account, if they have linked one
+	Avalon *AvalonAccount `bson:"avalon,omitempty"`
+}
+
+func (u *User) IsApproved() bool {
+	return u.Status == UserApproved
+}
+
+func (u *User) IsAdmin() bool {
+	return u.IsApproved() && u.Role == RoleAdmin
+}